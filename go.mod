@@ -3,25 +3,26 @@ module github.com/kt-soft-dev/kt-cli
 go 1.20
 
 require (
+	github.com/ProtonMail/go-crypto v1.1.0-alpha.1-proton
 	github.com/ProtonMail/gopenpgp/v2 v2.8.0-alpha.1-proton
 	github.com/fatih/color v1.16.0
+	github.com/mitchellh/mapstructure v1.5.0
 	github.com/rodaine/table v1.2.0
 	github.com/schollz/progressbar/v3 v3.14.2
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	golang.org/x/crypto v0.17.0
+	golang.org/x/sys v0.17.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
-	github.com/ProtonMail/go-crypto v1.1.0-alpha.1-proton // indirect
 	github.com/ProtonMail/go-mime v0.0.0-20230322103455-7d82a3887f2f // indirect
 	github.com/cloudflare/circl v1.3.7 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
-	github.com/mitchellh/mapstructure v1.5.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	golang.org/x/sys v0.17.0 // indirect
 	golang.org/x/term v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
@@ -32,7 +32,9 @@ func ActionDefault(config *Config) {
 	// Usually, in case of empty method and non-empty token,
 	// we should take this as a request to validate and store the token
 	if *Auth != "" {
-		_ = CheckTokenAndAssign(config.Token, config)
+		if CheckTokenAndAssign(config.Token, config) != nil {
+			return
+		}
 		Print("Token is validated and saved")
 		// Config will be saved because of the deferring above (if no -no-save flag is set)
 		return
@@ -41,12 +43,18 @@ func ActionDefault(config *Config) {
 	flag.PrintDefaults()
 }
 
+// ActionGetKeys exports keys of the disk into files. The private key file is readable only by the owner,
+// and existing files are not overwritten without -force
 func ActionGetKeys(config *Config) {
 	_, disk, err := DiskIdOrDefault(config, *GetKeys)
 	if err != nil {
 		PrintError(err.Error())
 		return
 	}
+	if err = pkg.VerifyDiskKey(disk); err != nil {
+		PrintError(err.Error())
+		return
+	}
 
 	cryptoInfo := &pkg.CryptoInfo{
 		EncryptedCryptoKey: disk.CryptoKey,
@@ -62,14 +70,49 @@ func ActionGetKeys(config *Config) {
 		}
 	}
 
-	err = os.WriteFile(*GetKeysPublicName, []byte(cryptoInfo.PublicKey), 0755)
-	if err != nil {
-		PrintError(err.Error())
+	// The key agent keeps the key unlocked, so without the password it can only be exported locked with a new passphrase
+	if cryptoInfo.Password == "" && !*GetKeysRelock {
+		PrintError("The key is received from key agent without the password. Set -passwd or use -act.keys.relock to export it")
+		return
+	}
+
+	privateKey := cryptoInfo.RawCryptoKey
+	if *GetKeysRelock {
+		passphrase := *GetKeysRelockPass
+		if passphrase == "" {
+			if passphrase, err = readNewSecret("New passphrase of the exported key: "); err != nil {
+				PrintError(err.Error())
+				return
+			}
+		}
+
+		privateKey, err = pkg.RelockPrivateKey(privateKey, []byte(cryptoInfo.Password), []byte(passphrase))
+		if err != nil {
+			PrintError("Failed to lock the key with the new passphrase: %s", err.Error())
+			return
+		}
+	}
+
+	if *GetKeysPaper != "" {
+		backup, err := pkg.PaperBackup(privateKey, fmt.Sprintf("%s (%s)", disk.Title, disk.ID))
+		if err != nil {
+			PrintError("Failed to make paper backup: %s", err.Error())
+			return
+		}
+
+		if err = writeKeyFiles(keyFile{*GetKeysPaper, backup, 0600}); err != nil {
+			PrintError(err.Error())
+			return
+		}
+
+		Print("Paper backup of the private key exported: %s. Print it and delete the file", *GetKeysPaper)
+		return
 	}
 
-	err = os.WriteFile(*GetKeysPrivateName, []byte(cryptoInfo.RawCryptoKey), 0755)
+	err = writeKeyFiles(keyFile{*GetKeysPublicName, cryptoInfo.PublicKey, 0644}, keyFile{*GetKeysPrivateName, privateKey, 0600})
 	if err != nil {
 		PrintError(err.Error())
+		return
 	}
 
 	Print("Keys exported: %s, %s", *GetKeysPublicName, *GetKeysPrivateName)
@@ -114,7 +157,15 @@ func ActionDownload(config *Config) {
 
 // ActionUpload uploads a file to the cloud. The file can be provided by path or by stdin.
 func ActionUpload(config *Config, isStdIn bool) {
-	*UploadDisk, _, _ = DiskIdOrDefault(config, *UploadDisk)
+	var err error
+	*UploadDisk, _, err = DiskIdOrDefault(config, *UploadDisk)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+	if *UploadFolder == "" {
+		*UploadFolder = *FolderFlag
+	}
 
 	var reader io.Reader
 	var name string
@@ -142,8 +193,12 @@ func ActionUpload(config *Config, isStdIn bool) {
 			return
 		}
 		if fileInfo.IsDir() {
-			// @todo directory uploading
-			PrintError("Directory uploading is not supported yet")
+			uploadDirectory(config, path)
+			return
+		}
+
+		if err = CheckSpaceFor(config, fileInfo.Size()); err != nil {
+			PrintError(err.Error())
 			return
 		}
 
@@ -162,7 +217,7 @@ func ActionUpload(config *Config, isStdIn bool) {
 		reader = file
 	}
 
-	_, err := pkg.UploadFile(config.Token, name, "", *UploadDisk, *UploadFolder, NewDefaultCryptoInfo(), reader)
+	_, err = pkg.UploadFile(config.Token, name, "", *UploadDisk, *UploadFolder, NewDefaultCryptoInfo(), reader)
 	if err != nil {
 		PrintError(err.Error())
 		return
@@ -170,20 +225,15 @@ func ActionUpload(config *Config, isStdIn bool) {
 }
 
 func ActionFilesList(config *Config) {
-	*FilesList, _, _ = DiskIdOrDefault(config, *FilesList)
-
-	// @todo offsets for big lists
-	filesList, err := pkg.ApiRequest(config.Token, "files.get", map[string]interface{}{"disk": *FilesList, "offset": 0})
+	var err error
+	*FilesList, _, err = DiskIdOrDefault(config, *FilesList)
 	if err != nil {
 		PrintError(err.Error())
 		return
 	}
-	if filesList.Error.Code != 0 {
-		PrintError(filesList.Error.Message)
-		return
-	}
 
-	resp, err := pkg.MapToStruct[pkg.FilesGetResponse](filesList.Result)
+	// @todo offsets for big lists
+	resp, err := pkg.GetFiles(config.Token, *FilesList, "", 0)
 	if err != nil {
 		PrintError(err.Error())
 		return
@@ -224,16 +274,14 @@ func ActionAskForToken(config *Config) {
 		return
 	}
 
-	// @todo prompt for email and password to get the token or use web auth
 	Print("Enter your access token to use most functions or leave it blank to proceed with anonymous requests." +
+		"\n You can also log in with your email and password by -act.login flag, or in the browser by -act.login.web flag." +
 		"\n When you enter your password, the characters will not be displayed." +
 		"\n This is a security measure to prevent it from being stored in SSH logs.\n")
 	fmt.Print("Access token: ")
 	password, err := terminal.ReadPassword(0)
 	if err == nil && len(password) > 0 {
-		if CheckTokenAndAssign(string(password), config) != nil {
-			config.Token = string(password)
-		}
+		_ = CheckTokenAndAssign(string(password), config)
 	} else {
 		PrintError(err.Error())
 	}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"os"
+)
+
+// ActionWhoAmI prints the account info, its disks and the space usage
+func ActionWhoAmI(config *Config) {
+	user, err := pkg.GetUserInfo(config.Token)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("User ID: %s", user.ID)
+	Print("Email: %s", user.Email)
+
+	disks, err := pkg.GetUserDisks(config.Token)
+	if err != nil {
+		PrintError(err.Error())
+	} else {
+		for _, disk := range disks {
+			Print("Disk: %s (%s)", disk.Title, disk.ID)
+		}
+	}
+
+	printSpace(user)
+}
+
+// ActionQuota prints the space usage of the account
+func ActionQuota(config *Config) {
+	user, err := pkg.GetUserInfo(config.Token)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	printSpace(user)
+}
+
+func printSpace(user *pkg.UserInfo) {
+	Print("Total space: %s", ByteCount(user.PrepaidSpace))
+	Print("Used space: %s", ByteCount(user.UsedSpace()))
+	Print("Available space: %s", ByteCount(user.AvailableSpace))
+}
+
+// CheckSpaceFor checks if the data of the known size fits into the available space.
+// The returned error has a human-readable message
+func CheckSpaceFor(config *Config, size int64) error {
+	err := pkg.CheckAvailableSpace(config.Token, size)
+
+	var spaceErr *pkg.NotEnoughSpaceError
+	if errors.As(err, &spaceErr) {
+		return fmt.Errorf("not enough space: %s required, but only %s available",
+			ByteCount(spaceErr.Required), ByteCount(spaceErr.Available))
+	}
+
+	return err
+}
+
+// ActionLogin asks for email and password and gets the token. The second factor code is asked if the server requires it.
+// With -act.login.web flag the token is received from the web app instead.
+// The token is validated and saved to the config like the one provided by -token flag
+func ActionLogin(config *Config) {
+	if *LoginWeb {
+		token, err := webLoginToken()
+		if err != nil {
+			PrintError("Login failed: %s", err.Error())
+			return
+		}
+
+		_ = CheckTokenAndAssign(token, config)
+		return
+	}
+
+	if *NotInteractive {
+		PrintError("Login requires interactive mode. Use -token flag or KT_CLI_TOKEN environment variable instead")
+		return
+	}
+
+	token, err := loginWithPassword()
+	if err != nil {
+		PrintError("Login failed: %s", err.Error())
+		return
+	}
+
+	if CheckTokenAndAssign(token, config) != nil {
+		return
+	}
+
+	if *NoConfigSave {
+		Print("Token is not saved because of -no-save flag")
+	}
+}
+
+// ActionLogout revokes the token on the server and removes it from the config with the user id and sealed secrets.
+// Private key files are deleted only with -act.logout.keys. With -act.logout.all flag it's done for every profile
+func ActionLogout(config *Config) {
+	if *NoConfigSave {
+		PrintError("Logout can't be saved with -no-save flag")
+		return
+	}
+
+	keyFiles := []string{*PrivateKeyFile}
+	if *LogoutAll {
+		for _, profile := range config.inactiveProfiles() {
+			if profile.PrivateKeyFile != "" {
+				keyFiles = append(keyFiles, profile.PrivateKeyFile)
+			}
+			token, err := config.unsealProfile(profile)
+			if err != nil {
+				PrintError("Failed to unseal a token, it is removed locally only: %s", err.Error())
+			} else if token != "" {
+				revokeToken(token, profile.Endpoint)
+			}
+
+			profile.ClearCredentials()
+		}
+	}
+
+	if config.Token != "" {
+		revokeToken(config.Token, *Endpoint)
+	}
+	config.ClearCredentials()
+	config.passphrase = nil
+	config.sealedPasswd = ""
+
+	// Unlocked keys must not outlive the session
+	if err := pkg.AgentForgetKeys(); err == nil {
+		Print("Keys are removed from key agent")
+	} else if !errors.Is(err, pkg.ErrNoAgent) {
+		PrintError("Failed to remove keys from key agent: %s", err.Error())
+	}
+
+	if *LogoutKeys {
+		for _, keyFile := range keyFiles {
+			err := os.Remove(keyFile)
+			if err != nil && !os.IsNotExist(err) {
+				PrintError("Failed to delete private key file %s: %s", keyFile, err.Error())
+			} else if err == nil {
+				Print("Private key file %s deleted", keyFile)
+			}
+		}
+	}
+
+	Print("Logged out")
+}
+
+// revokeToken revokes the token on the server of the endpoint. Failures are not fatal, the token is removed locally anyway
+func revokeToken(token string, endpoint string) {
+	pkg.SetEndpoint(endpoint)
+	defer pkg.SetEndpoint(*Endpoint)
+
+	err := pkg.RevokeToken(token)
+	if err != nil {
+		PrintError("Failed to revoke the token on the server, it is removed locally only: %s", err.Error())
+	}
+}
+
+// loginWithPassword asks for email, password and the second factor code if needed, and returns the new token
+func loginWithPassword() (string, error) {
+	email := *LoginEmail
+	if email == "" {
+		email = pkg.ScanOrDefault("Email: ", "")
+		if email == "" {
+			return "", errors.New("email is required")
+		}
+	}
+
+	password, err := ReadSecret("Password: ")
+	if err != nil {
+		return "", err
+	}
+
+	result, err := pkg.Login(email, password)
+	if err != nil {
+		return "", err
+	}
+
+	if result.TwoFactor {
+		code := pkg.ScanOrDefault("Second factor code: ", "")
+		if code == "" {
+			return "", errors.New("second factor code is required")
+		}
+
+		result, err = pkg.LoginTwoFactor(result.Ticket, code)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return result.Token, nil
+}
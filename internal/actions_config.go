@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"gopkg.in/yaml.v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// secretFlags are the flags which values are never printed
+var secretFlags = map[string]bool{"token": true, "passwd": true}
+
+// ActionConfigShow prints effective values of the global flags and, with -act.config.show.origin, their origins
+func ActionConfigShow(config *Config) {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	columns := []interface{}{"Setting", "Value"}
+	if *ConfigShowOrigin {
+		columns = append(columns, "Origin", "Environment variable")
+	}
+	tbl := table.New(columns...)
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Name, "act.") || f.Name == "params" {
+			return
+		}
+
+		value, origin := f.Value.String(), FlagOrigin(f.Name)
+		switch f.Name {
+		case "profile":
+			value = config.ProfileName()
+		case "token":
+			// The token is usually stored in the config, not passed by the flag
+			value = config.Token
+			if origin == originDefault && value != "" {
+				origin = fmt.Sprintf("user config %s (profile %s)", *ConfigFilename, config.ProfileName())
+			}
+		}
+		if secretFlags[f.Name] && value != "" {
+			value = "(hidden)"
+		}
+
+		row := []interface{}{f.Name, value}
+		if *ConfigShowOrigin {
+			row = append(row, origin, EnvName(f.Name))
+		}
+		tbl.AddRow(row...)
+	})
+
+	tbl.Print()
+}
+
+// ActionConfigList prints all settings of the active profile. Secrets are hidden
+func ActionConfigList(config *Config) {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	Print("Profile %s in %s", config.ProfileName(), *ConfigFilename)
+	tbl := table.New("Key", "Value", "Description")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+
+	for i := range ConfigKeys {
+		key := &ConfigKeys[i]
+		value, ok, err := key.Get(&config.Profile)
+		switch {
+		case err != nil:
+			value = err.Error()
+		case !ok:
+			value = "(not set)"
+		case key.Secret:
+			value = "(hidden)"
+		}
+
+		tbl.AddRow(key.Name, value, key.Description)
+	}
+
+	tbl.Print()
+}
+
+// ActionConfigGet prints the setting of the active profile
+func ActionConfigGet(config *Config) {
+	key, err := FindConfigKey(*ConfigGet)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	value, ok, err := key.Get(&config.Profile)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	} else if !ok {
+		PrintError("%s is not set in profile %s", key.Name, config.ProfileName())
+		return
+	}
+
+	Print(value)
+}
+
+// ActionConfigSet changes the setting of the active profile. The value is validated against the schema
+func ActionConfigSet(config *Config) {
+	name, value, ok := strings.Cut(*ConfigSet, "=")
+	if !ok {
+		PrintError("Use key=value format, e.g. -act.config.set=retries=3")
+		return
+	}
+
+	key, err := FindConfigKey(name)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	if err = key.Set(&config.Profile, strings.TrimSpace(value)); err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("%s is set to %s in profile %s", key.Name, strings.TrimSpace(value), config.ProfileName())
+}
+
+// ActionConfigUnset removes the setting from the active profile
+func ActionConfigUnset(config *Config) {
+	key, err := FindConfigKey(*ConfigUnset)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	if err = key.Unset(&config.Profile); err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("%s is removed from profile %s", key.Name, config.ProfileName())
+}
+
+// ActionConfigEdit opens a copy of the config file in the editor. The edited config replaces the loaded one
+// only if it is valid, and it's saved on exit like any other change, merged with changes of other processes
+func ActionConfigEdit(config *Config) {
+	data, err := config.marshal()
+	if err != nil {
+		PrintError("Failed to prepare config: %s", err.Error())
+		return
+	}
+
+	// The copy contains the token, so it's created in the config directory with the same permissions
+	dir := filepath.Dir(*ConfigFilename)
+	_ = os.MkdirAll(dir, 0700)
+	file, err := os.CreateTemp(dir, "edit-*.yaml")
+	if err != nil {
+		PrintError("Failed to create temporary file: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		PrintError("Failed to write temporary file: %s", err.Error())
+		return
+	}
+
+	if err = runEditor(file.Name()); err != nil {
+		PrintError("Editor failed: %s", err.Error())
+		return
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		PrintError("Failed to read edited config: %s", err.Error())
+		return
+	}
+	if bytes.Equal(edited, data) {
+		Print("Config is not changed")
+		return
+	}
+
+	editedConfig := &Config{}
+	if err = yaml.UnmarshalStrict(edited, editedConfig); err != nil {
+		PrintError("Edited config is not saved: %s", err.Error())
+		return
+	}
+	if err = editedConfig.migrate(); err == nil {
+		err = editedConfig.Validate()
+	}
+	if err != nil {
+		PrintError("Edited config is not saved: %s", err.Error())
+		return
+	}
+
+	if err = config.applyFileView(editedConfig); err != nil {
+		PrintError("Edited config is not saved: %s", err.Error())
+		return
+	}
+	Print("Config is updated")
+}
+
+// runEditor opens the file in the editor from VISUAL or EDITOR environment variables and waits for it to exit
+func runEditor(filename string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// The editor can be set with arguments, like "code --wait"
+	args := append(strings.Fields(editor), filename)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Crypt actions encrypt and decrypt files with the key files (-public and -private) and -passwd without any requests
+// to the server, e.g. on an air-gapped machine. Messages are the same as uploaded and downloaded ones
+
+// ActionCryptEncrypt encrypts the file or stdin ("-") with the public key file. It is signed with the private key file
+// if the password is provided
+func ActionCryptEncrypt() {
+	input, output := *CryptEncrypt, *CryptOut
+	if output == "" {
+		output = "-"
+		if input != "-" {
+			output = input + ".pgp"
+		}
+	}
+	if output == "-" {
+		// Messages go to stderr, so they don't mix with the data
+		SetPrintOutput(os.Stderr)
+	}
+
+	cryptoInfo, err := offlineCryptoInfo(false, false)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	reader, closeReader, err := openCryptInput(input)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+	defer closeReader()
+
+	writer, closeWriter, err := createCryptOutput(output, 0644)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	name := ""
+	if input != "-" {
+		name = filepath.Base(input)
+	}
+
+	err = pkg.EncryptData(writer, reader, name, cryptoInfo)
+	if err = closeWriter(err); err != nil {
+		PrintError("Failed to encrypt: %s", err.Error())
+		return
+	}
+
+	if output != "-" {
+		Print("Encrypted into %s", output)
+	}
+}
+
+// ActionCryptDecrypt decrypts the file or stdin ("-") with the private key file and the password.
+// The signature is checked with the public key file according to -signatures policy
+func ActionCryptDecrypt() {
+	input, output := *CryptDecrypt, *CryptOut
+	if output == "" {
+		switch {
+		case input == "-":
+			output = "-"
+		case strings.HasSuffix(input, ".pgp"):
+			output = strings.TrimSuffix(input, ".pgp")
+		default:
+			PrintError("Set the output file with -act.crypt.out")
+			return
+		}
+	}
+	if output == "-" {
+		SetPrintOutput(os.Stderr)
+	}
+
+	// The password can't be asked if the message is read from stdin
+	cryptoInfo, err := offlineCryptoInfo(true, input != "-")
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	reader, closeReader, err := openCryptInput(input)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+	defer closeReader()
+
+	// The decrypted file replaces the output only after the message is decrypted and verified,
+	// so nothing is left on failure. The content written to stdout can't be taken back, the error is printed after it
+	writer, closeWriter, err := createCryptOutput(output, 0600)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	_, err = pkg.DecryptStream(writer, reader, cryptoInfo)
+	if err = closeWriter(err); err != nil {
+		PrintError("Failed to decrypt: %s", err.Error())
+		return
+	}
+
+	if output != "-" {
+		Print("Decrypted into %s", output)
+	}
+}
+
+// offlineCryptoInfo reads the key files and the password. Nothing is requested from the server.
+// If withPrivate is true, the private key is required and the password is asked if it's not provided
+// and can be asked
+func offlineCryptoInfo(withPrivate bool, canAsk bool) (*pkg.CryptoInfo, error) {
+	cryptoInfo := NewDefaultCryptoInfo()
+
+	if !withPrivate && !cryptoInfo.IsEncryptReady() {
+		return nil, fmt.Errorf("public key file %s is not found, set -public", *PublicKeyFile)
+	}
+	if withPrivate && !cryptoInfo.IsCryptoReady() {
+		return nil, fmt.Errorf("private key file %s is not found, set -private", *PrivateKeyFile)
+	}
+
+	if withPrivate && canAsk && cryptoInfo.Password == "" && !*NotInteractive {
+		password, err := ReadSecret("Disk password: ")
+		if err != nil {
+			return nil, err
+		}
+		cryptoInfo.Password = password
+	}
+
+	return cryptoInfo, nil
+}
+
+// openCryptInput opens the input file or stdin if the path is "-"
+func openCryptInput(path string) (io.Reader, func(), error) {
+	if path == "-" {
+		return os.Stdin, func() {}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, func() { _ = file.Close() }, nil
+}
+
+// createCryptOutput creates the output file or uses stdout if the path is "-". Existing files are not overwritten
+// without -force. The content is written into a temporary file, and the returned function replaces the output with it
+// if the operation succeeded, so an existing file is kept if it failed
+func createCryptOutput(path string, perm os.FileMode) (io.Writer, func(error) error, error) {
+	if path == "-" {
+		return os.Stdout, func(err error) error { return err }, nil
+	}
+
+	if _, err := os.Stat(path); err == nil && !*Force {
+		return nil, nil, errors.New(path + " already exists, use -force to overwrite")
+	}
+
+	file, err := createFileAtomic(path, perm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, file.commit, nil
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"github.com/fatih/color"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"github.com/rodaine/table"
+)
+
+// ActionDisks prints all user's disks and marks the default one
+func ActionDisks(config *Config) {
+	disks, err := pkg.GetUserDisks(config.Token)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+	if len(disks) == 0 {
+		PrintError("Disk list is empty")
+		return
+	}
+
+	defaultDisk, err := pkg.FindDisk(disks, *DiskFlag)
+	if err != nil {
+		PrintError("Default disk from %s is not available: %s", FlagOrigin("disk"), err.Error())
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("ID", "Title", "Encryption", "Default")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+
+	for _, disk := range disks {
+		encryption := "no keys"
+		if disk.PublicKey != "" {
+			encryption = "ready"
+		}
+
+		isDefault := ""
+		if disk == defaultDisk {
+			isDefault = "*"
+		}
+
+		tbl.AddRow(disk.ID, disk.Title, encryption, isDefault)
+	}
+
+	tbl.Print()
+}
+
+// ActionDiskDefault sets the default disk in the config. It will be used when no disk is provided to other actions
+func ActionDiskDefault(config *Config) {
+	if *DiskDefault == "." {
+		config.DefaultDisk = ""
+		Print("Default disk is reset to the first user's disk")
+		return
+	}
+
+	id, disk, err := DiskIdOrDefault(config, *DiskDefault)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	config.DefaultDisk = id
+	Print("Default disk is set to %s (%s)", disk.Title, id)
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"github.com/kt-soft-dev/kt-cli/pkg"
+)
+
+// ActionRename renames the file or the folder (with -act.folder flag)
+func ActionRename(config *Config) {
+	name := *RenameName
+	if name == "" {
+		name = pkg.ScanOrDefault("Enter new name: ", "")
+		if name == "" {
+			PrintError("New name is required. Use -act.rename.name flag")
+			return
+		}
+	}
+
+	var err error
+	if *IsFolder {
+		err = pkg.RenameFolder(config.Token, *Rename, name)
+	} else {
+		err = pkg.RenameFile(config.Token, *Rename, name)
+	}
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("%s renamed to %s", *Rename, name)
+}
+
+// ActionMove moves the file or the folder (with -act.folder flag) to another folder and/or disk
+func ActionMove(config *Config) {
+	disk, err := targetDiskId(config, *MoveDisk)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	if *IsFolder {
+		err = pkg.MoveFolder(config.Token, *Move, disk, *MoveFolder)
+	} else {
+		err = pkg.MoveFile(config.Token, *Move, disk, *MoveFolder)
+	}
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("%s moved", *Move)
+}
+
+// ActionCopy copies the file to another folder and/or disk and prints the ID of the copy
+func ActionCopy(config *Config) {
+	if *IsFolder {
+		PrintError("Copying folders is not supported")
+		return
+	}
+
+	disk, err := targetDiskId(config, *CopyDisk)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	fileId, err := pkg.CopyFile(config.Token, *Copy, disk, *CopyFolder)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("%s copied. New file ID: %s", *Copy, fileId)
+}
+
+// ActionDelete deletes the file or the folder (with -act.folder flag) after confirmation
+func ActionDelete(config *Config) {
+	kind := "file"
+	if *IsFolder {
+		kind = "folder with all its contents"
+	}
+
+	if !Confirm("Delete " + kind + " " + *Delete + "?") {
+		PrintError("Deletion is not confirmed. Use -yes flag to skip confirmation")
+		return
+	}
+
+	var err error
+	if *IsFolder {
+		err = pkg.DeleteFolder(config.Token, *Delete)
+	} else {
+		err = pkg.DeleteFile(config.Token, *Delete)
+	}
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("%s deleted", *Delete)
+}
+
+// ActionMkdir creates the folder by path. With -act.mkdir.p flag missing parents are created too
+func ActionMkdir(config *Config) {
+	disk, _, err := DiskIdOrDefault(config, *MkdirDisk)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	folder, err := pkg.MakeFolderPath(config.Token, disk, *MkdirParent, *Mkdir, *MkdirParents)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("Folder %s is ready. Folder ID: %s", *Mkdir, folder.ID)
+}
+
+// targetDiskId resolves the target disk of move and copy actions. Empty disk means the current disk of the file
+func targetDiskId(config *Config, disk string) (string, error) {
+	if disk == "" {
+		return "", nil
+	}
+
+	id, _, err := DiskIdOrDefault(config, disk)
+	return id, err
+}
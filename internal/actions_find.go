@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"github.com/rodaine/table"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ActionFind searches files in the disk by the conditions from -act.find.* flags.
+// Found files are printed as a table, or as JSON with the folder path of each file in JSON mode
+func ActionFind(config *Config) {
+	disk, _, err := DiskIdOrDefault(config, *Find)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	filter, err := newFindFilter()
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	files, err := pkg.SearchFiles(config.Token, disk, *FindFolder, filter)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+	if IsJsonMode() {
+		list := make([]map[string]interface{}, 0, len(files))
+		for _, file := range files {
+			entry, err := pkg.StructToMap(file.File)
+			if err != nil {
+				PrintError(err.Error())
+				return
+			}
+			entry["path"] = file.Path
+			list = append(list, entry)
+		}
+
+		PrintJson(map[string]interface{}{"count": len(list), "list": list})
+		return
+	}
+	if len(files) == 0 {
+		PrintError("No files found")
+		return
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("ID", "Path", "Name", "Type", "Size", "Date")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+
+	for _, file := range files {
+		date := time.Unix(int64(file.Date), 0).Format(time.DateTime)
+		tbl.AddRow(file.ID, file.Path, file.Name, file.Mime, ByteCount(int64(file.Size)), date)
+	}
+
+	tbl.Print()
+}
+
+// newFindFilter creates the filter from -act.find.* flags
+func newFindFilter() (*pkg.FileFilter, error) {
+	filter := &pkg.FileFilter{
+		Name: *FindName,
+		Mime: *FindMime,
+	}
+
+	if *FindRegex != "" {
+		re, err := regexp.Compile(*FindRegex)
+		if err != nil {
+			return nil, fmt.Errorf("bad regular expression: %w", err)
+		}
+		filter.NameRegexp = re
+	}
+
+	for _, condition := range strings.Split(*FindSize, ",") {
+		condition = strings.TrimSpace(condition)
+		if condition == "" {
+			continue
+		}
+
+		size, err := ParseSize(strings.TrimLeft(condition, "+-"))
+		if err != nil {
+			return nil, err
+		}
+
+		switch condition[0] {
+		case '+':
+			filter.MinSize = size + 1
+		case '-':
+			if size == 0 {
+				return nil, fmt.Errorf("size can't be less than zero")
+			}
+			maxSize := size - 1
+			filter.MaxSize = &maxSize
+		default:
+			filter.MinSize, filter.MaxSize = size, &size
+		}
+	}
+
+	var err error
+	if *FindAfter != "" {
+		if filter.After, err = ParseTime(*FindAfter); err != nil {
+			return nil, err
+		}
+	}
+	if *FindBefore != "" {
+		if filter.Before, err = ParseTime(*FindBefore); err != nil {
+			return nil, err
+		}
+	}
+
+	if filter.Encrypted, err = parseOptionalBool(*FindEncrypted); err != nil {
+		return nil, err
+	}
+	if filter.Shared, err = parseOptionalBool(*FindShared); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// parseOptionalBool parses the boolean flag value, empty value means the flag is not set
+func parseOptionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("bad boolean value %q", value)
+	}
+
+	return &result, nil
+}
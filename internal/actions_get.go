@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ActionGet downloads the publicly shared file by its link without a token.
+// The file is streamed to the provided path or to stdout if the path is "-".
+// Existing files are not overwritten without -force or confirmation
+func ActionGet() {
+	secret, err := pkg.ParseShareURL(*Get)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	savePath := strings.TrimSpace(*GetPath)
+	if savePath == "" {
+		PrintError("Save path is required")
+		return
+	} else if savePath == "-" {
+		SetPrintOutput(os.Stderr)
+	}
+
+	cryptoInfo, err := sharedCryptoInfo()
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	// The info is passed to the download, so it isn't requested twice
+	fileInfo, err := pkg.GetSharedFile(secret)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	if savePath == "-" {
+		_, err = pkg.DownloadSharedFileWithInfo(secret, fileInfo, os.Stdout, cryptoInfo)
+		if err != nil {
+			PrintError(err.Error())
+		}
+		return
+	}
+
+	pathInfo, err := os.Stat(savePath)
+	if err == nil && pathInfo.IsDir() {
+		// The name comes from another user, so we don't let it point outside the directory
+		if !pkg.IsValidFileName(fileInfo.Name) {
+			PrintError("Shared file name %q can't be used, set the file path with -act.get.path", fileInfo.Name)
+			return
+		}
+		savePath = filepath.Join(savePath, fileInfo.Name)
+	}
+
+	if _, err = os.Stat(savePath); err == nil && !*Force && !Confirm(fmt.Sprintf("File %s already exists. Overwrite it?", savePath)) {
+		PrintError("%s already exists, use -force to overwrite", savePath)
+		return
+	}
+
+	// The download goes into a temporary file, so the existing file isn't lost if it fails
+	out, err := createFileAtomic(savePath, 0644)
+	if err != nil {
+		PrintError("Failed to create file %s", savePath)
+		return
+	}
+
+	_, err = pkg.DownloadSharedFileWithInfo(secret, fileInfo, out, cryptoInfo)
+	if err = out.commit(err); err != nil {
+		PrintError(err.Error())
+	}
+}
+
+// sharedCryptoInfo returns the keys and the password the sharer gave for the file. Only key files set
+// in the command line or the environment are used: the default ones and the ones from config files are the keys
+// of the user's own disk, and the signature would be checked against them
+func sharedCryptoInfo() (*pkg.CryptoInfo, error) {
+	info := &pkg.CryptoInfo{Password: *Passwd}
+
+	if isFlagExplicit("private") {
+		data, err := os.ReadFile(*PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key file: %w", err)
+		}
+		info.RawCryptoKey, info.EncryptedCryptoKey = privateKeyFromFile(string(data), info.Password)
+	}
+	if isFlagExplicit("public") {
+		data, err := os.ReadFile(*PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key file: %w", err)
+		}
+		info.PublicKey = string(data)
+	}
+
+	return info, nil
+}
+
+// isFlagExplicit checks if the flag is set in the command line or by its environment variable
+func isFlagExplicit(name string) bool {
+	origin := FlagOrigin(name)
+	return origin == originCommandLine || strings.HasPrefix(origin, "environment variable")
+}
@@ -0,0 +1,472 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"os"
+	"strings"
+	"time"
+)
+
+// ActionKeysTrust pins the current public key of the disk after the user confirms its fingerprint
+func ActionKeysTrust(config *Config) {
+	_, disk, err := DiskIdOrDefault(config, *KeysTrust)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+	if disk.PublicKey == "" {
+		PrintError("Disk %s has no public key", disk.Title)
+		return
+	}
+
+	fingerprint, err := pkg.KeyFingerprint(disk.PublicKey)
+	if err != nil {
+		PrintError("Bad public key of disk %s: %s", disk.Title, err.Error())
+		return
+	}
+
+	pinned, ok := config.KnownKeys[disk.ID]
+	if ok && pinned == fingerprint {
+		Print("Public key of disk %s is already trusted, fingerprint %s", disk.Title, fingerprint)
+		return
+	}
+
+	if ok {
+		Print("Pinned fingerprint:  %s", pinned)
+	}
+	Print("Current fingerprint: %s", fingerprint)
+	Print("Compare it with the fingerprint shown in the web app or by another trusted device")
+	if !Confirm("Trust this key for disk " + disk.Title + "?") {
+		PrintError("Key is not trusted")
+		return
+	}
+
+	if config.KnownKeys == nil {
+		config.KnownKeys = make(map[string]string)
+	}
+	config.KnownKeys[disk.ID] = fingerprint
+	Print("Public key of disk %s is trusted", disk.Title)
+}
+
+// ActionKeysPasswd changes the disk password. The crypto key stored on the server is re-encrypted with the new password
+func ActionKeysPasswd(config *Config) {
+	_, disk, err := DiskIdOrDefault(config, *KeysPasswd)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	oldPassword, err := askDiskPassword("Current disk password: ")
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	newPassword := *KeysPasswdNew
+	if newPassword == "" {
+		if newPassword, err = readNewSecret("New disk password: "); err != nil {
+			PrintError(err.Error())
+			return
+		}
+	}
+	if newPassword == oldPassword {
+		PrintError("New password is the same as the current one")
+		return
+	}
+
+	if err = pkg.ChangeCryptoKeyPassword(config.Token, disk.ID, oldPassword, newPassword); err != nil {
+		PrintError("Password is not changed: %s", err.Error())
+		return
+	}
+
+	// The password kept in the secrets store would not work anymore
+	if config.sealedPasswd != "" && config.sealedPasswd == oldPassword {
+		config.sealedPasswd = newPassword
+		Print("Password in the secrets store is updated")
+	}
+
+	Print("Password of disk %s is changed", disk.Title)
+	if _, err = os.Stat(*PrivateKeyFile); err == nil {
+		Print("Private key file %s is still protected with the old password, export the keys again", *PrivateKeyFile)
+	}
+}
+
+// askDiskPassword returns the disk password from -passwd or asks for it
+func askDiskPassword(prompt string) (string, error) {
+	if *Passwd != "" {
+		return *Passwd, nil
+	}
+	if *NotInteractive {
+		return "", errors.New("disk password is required, set -passwd or KT_CLI_PASSWD")
+	}
+
+	return ReadSecret(prompt)
+}
+
+// readNewSecret asks for a new secret twice to make sure it's typed correctly
+func readNewSecret(prompt string) (string, error) {
+	if *NotInteractive {
+		return "", errors.New("new password can't be asked in non-interactive mode")
+	}
+
+	secret, err := ReadSecret(prompt)
+	if err != nil {
+		return "", err
+	}
+	if secret == "" {
+		return "", errors.New("password is empty")
+	}
+
+	repeated, err := ReadSecret("Repeat: ")
+	if err != nil {
+		return "", err
+	}
+	if repeated != secret {
+		return "", errors.New("passwords do not match")
+	}
+
+	return secret, nil
+}
+
+// ActionKeysImport restores keys exported by -act.keys, also from a paper backup, into -public and -private files.
+// The private key is checked with its passphrase, and it's locked with the disk password (-passwd) if they differ
+func ActionKeysImport(config *Config) {
+	data, err := os.ReadFile(*KeysImport)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	privateKey, err := pkg.ParseKeyBackup(string(data))
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	key, err := crypto.NewKeyFromArmored(privateKey)
+	if err != nil {
+		PrintError("Bad private key: %s", err.Error())
+		return
+	}
+	if !key.IsPrivate() {
+		PrintError("File %s has no private key", *KeysImport)
+		return
+	}
+	fingerprint := key.GetFingerprint()
+
+	publicKey, err := key.GetArmoredPublicKey()
+	if *KeysImportPublic != "" {
+		data, err = os.ReadFile(*KeysImportPublic)
+		publicKey = string(data)
+	}
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	publicFingerprint, err := pkg.KeyFingerprint(publicKey)
+	if err != nil {
+		PrintError("Bad public key: %s", err.Error())
+		return
+	}
+	if publicFingerprint != fingerprint {
+		PrintError("Public key doesn't match the private key")
+		return
+	}
+
+	passphrase, err := unlockImportedKey(key)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	// Key files are used with the disk password, so the key exported with another passphrase is locked with it again
+	if *Passwd != "" && passphrase != *Passwd {
+		if privateKey, err = pkg.RelockPrivateKey(privateKey, []byte(passphrase), []byte(*Passwd)); err != nil {
+			PrintError("Failed to lock the key with the disk password: %s", err.Error())
+			return
+		}
+		Print("Private key is locked with the disk password")
+	} else if *Passwd == "" {
+		Print("Private key is still locked with its passphrase, use it as -passwd")
+	}
+
+	err = writeKeyFiles(keyFile{*PublicKeyFile, publicKey, 0644}, keyFile{*PrivateKeyFile, privateKey, 0600})
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	for diskId, pinned := range config.KnownKeys {
+		if pinned == fingerprint {
+			Print("Key belongs to disk %s", diskId)
+		}
+	}
+	Print("Keys imported: %s, %s (fingerprint %s)", *PublicKeyFile, *PrivateKeyFile, fingerprint)
+}
+
+// unlockImportedKey checks the passphrase of the imported key and returns it. The passphrase is taken
+// from -act.keys.import.passphrase or -passwd, otherwise it's asked
+func unlockImportedKey(key *crypto.Key) (string, error) {
+	passphrase := *KeysImportPass
+	if passphrase == "" {
+		passphrase = *Passwd
+	}
+
+	unlocked, err := key.Unlock([]byte(passphrase))
+	if err != nil && passphrase != "" && *KeysImportPass != "" {
+		return "", errors.New("wrong passphrase of the key")
+	}
+	if err != nil {
+		if *NotInteractive {
+			return "", errors.New("passphrase of the key is required, set -act.keys.import.passphrase")
+		}
+		if passphrase, err = ReadSecret("Passphrase of the key: "); err != nil {
+			return "", err
+		}
+		if unlocked, err = key.Unlock([]byte(passphrase)); err != nil {
+			return "", errors.New("wrong passphrase of the key")
+		}
+	}
+	unlocked.ClearPrivateParams()
+
+	return passphrase, nil
+}
+
+// keyFile is the content of a key file to be written with its permissions
+type keyFile struct {
+	path string
+	data string
+	perm os.FileMode
+}
+
+// writeKeyFiles writes the key files. Without -force, nothing is written if any of the files exists
+func writeKeyFiles(files ...keyFile) error {
+	if !*Force {
+		var existing []string
+		for _, file := range files {
+			if _, err := os.Lstat(file.path); err == nil {
+				existing = append(existing, file.path)
+			}
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("%s already exists, use -force to overwrite", strings.Join(existing, ", "))
+		}
+	}
+
+	for _, file := range files {
+		if err := writeKeyFile(file); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.path, err)
+		}
+	}
+
+	return nil
+}
+
+// writeKeyFile writes the key file with its permissions. Existing files are replaced atomically with -force,
+// otherwise the file is created only if it doesn't exist
+func writeKeyFile(file keyFile) error {
+	if *Force {
+		if err := writeFileAtomic(file.path, []byte(file.data)); err != nil {
+			return err
+		}
+		return os.Chmod(file.path, file.perm)
+	}
+
+	output, err := os.OpenFile(file.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, file.perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = output.WriteString(file.data)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.path)
+	}
+
+	return err
+}
+
+// ActionKeysGenerate creates a key pair for the disk locally and stores it on the server. The private key is protected
+// with the disk password. Disks which already have keys are refused, see ActionKeysRotate
+func ActionKeysGenerate(config *Config) {
+	_, disk, err := DiskIdOrDefault(config, *KeysGenerate)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	// Replaced keys would be lost with all files encrypted with them, rotation keeps them until files are re-encrypted
+	if disk.PublicKey != "" || disk.CryptoKey != "" {
+		PrintError("Disk %s already has keys, use -act.keys.rotate to replace them", disk.Title)
+		return
+	}
+
+	password := *Passwd
+	if password == "" {
+		if password, err = readNewSecret("Disk password: "); err != nil {
+			PrintError(err.Error())
+			return
+		}
+	}
+
+	fingerprint, err := generateDiskKeys(config, disk, password)
+	if err != nil {
+		PrintError("Keys are not generated: %s", err.Error())
+		return
+	}
+
+	Print("Keys of disk %s are generated, fingerprint %s", disk.Title, fingerprint)
+}
+
+// ActionKeysRotate replaces keys of the disk with a new pair protected with the same password and re-encrypts
+// existing files with it. Interrupted re-encryption is continued when the action is run again
+func ActionKeysRotate(config *Config) {
+	_, disk, err := DiskIdOrDefault(config, *KeysRotate)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	state, err := loadRotationState(disk.ID)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	password, err := askDiskPassword("Disk password: ")
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	if state != nil {
+		Print("Keys of disk %s were replaced at %s, %d files are left to re-encrypt",
+			disk.Title, state.Started.Format(time.DateTime), len(state.Files))
+	} else if state, err = rotateDiskKeys(config, disk, password); err != nil {
+		PrintError("Keys are not replaced: %s", err.Error())
+		return
+	}
+
+	if len(state.Files) == 0 {
+		state.remove()
+		Print("Disk %s has no encrypted files to re-encrypt", disk.Title)
+		return
+	}
+	if !*KeysRotateFiles {
+		Print("%d encrypted files still use the old key, run -act.keys.rotate again to re-encrypt them", len(state.Files))
+		return
+	}
+
+	Print("Re-encrypting %d files in the foreground. If it's interrupted, run -act.keys.rotate again to continue", len(state.Files))
+	if err = reencryptFiles(config, state, password); err != nil {
+		PrintError("%s. Run -act.keys.rotate again to continue", err.Error())
+		return
+	}
+
+	Print("All files of disk %s are encrypted with the new key, old and new IDs are in %s", disk.Title, rotationLogPath(disk.ID))
+}
+
+// rotateDiskKeys replaces keys of the disk and returns the state with encrypted files to re-encrypt.
+// The state is saved before the keys are replaced, so the old key is never lost
+func rotateDiskKeys(config *Config, disk *pkg.Disk, password string) (*rotationState, error) {
+	if disk.PublicKey == "" || disk.CryptoKey == "" {
+		return nil, errors.New("disk has no keys, use -act.keys.generate")
+	}
+	if err := pkg.VerifyDiskKey(disk); err != nil {
+		return nil, err
+	}
+	if _, err := helper.DecryptMessageWithPassword([]byte(password), disk.CryptoKey); err != nil {
+		return nil, errors.New("wrong password")
+	}
+
+	state := &rotationState{
+		Endpoint:     *Endpoint,
+		DiskID:       disk.ID,
+		Started:      time.Now(),
+		OldPublicKey: disk.PublicKey,
+		OldCryptoKey: disk.CryptoKey,
+	}
+
+	shared := 0
+	err := pkg.WalkFiles(config.Token, disk.ID, "", func(path string, file *pkg.File) error {
+		if file.Encrypted {
+			state.Files = append(state.Files, file.ID)
+			if file.URLShared {
+				shared++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	if len(state.Files) > 0 {
+		Print("Re-encrypted files are uploaded again: they get new IDs and lose other server-side data. "+
+			"Old and new IDs are written to %s", rotationLogPath(disk.ID))
+	}
+	if shared > 0 {
+		Print("%d of the files are shared, their public links will stop working", shared)
+	}
+	if !Confirm(fmt.Sprintf("Replace keys of disk %s? %d encrypted files will need re-encryption", disk.Title, len(state.Files))) {
+		return nil, errors.New("cancelled")
+	}
+
+	if err = state.save(); err != nil {
+		return nil, fmt.Errorf("failed to save rotation state: %w", err)
+	}
+	if len(state.Files) > 0 {
+		err = appendRotationLog(disk.ID, "# old ID, new ID and name of files re-encrypted since "+state.Started.Format(time.DateTime))
+		if err != nil {
+			return nil, fmt.Errorf("failed to write ID log: %w", err)
+		}
+	}
+
+	fingerprint, err := generateDiskKeys(config, disk, password)
+	if err != nil {
+		// The old keys may be stored partially, so they are put back
+		if restoreErr := pkg.SetDiskKeys(config.Token, disk.ID, disk.PublicKey, disk.CryptoKey); restoreErr != nil {
+			PrintError("Failed to restore old keys, they are kept in %s: %s", rotationStatePath(disk.ID), restoreErr.Error())
+			return nil, err
+		}
+		state.remove()
+		return nil, err
+	}
+
+	Print("Keys of disk %s are replaced, new fingerprint %s", disk.Title, fingerprint)
+	return state, nil
+}
+
+// generateDiskKeys generates a key pair for the disk, stores it on the server and pins the new public key
+func generateDiskKeys(config *Config, disk *pkg.Disk, password string) (string, error) {
+	Print("Generating keys...")
+	keys, err := pkg.GenerateDiskKeys("ktCloud disk "+disk.Title, password)
+	if err != nil {
+		return "", err
+	}
+
+	fingerprint, err := pkg.KeyFingerprint(keys.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	if err = pkg.StoreDiskKeys(config.Token, disk.ID, keys, password); err != nil {
+		return "", err
+	}
+
+	pinningMutex.Lock()
+	if config.KnownKeys == nil {
+		config.KnownKeys = make(map[string]string)
+	}
+	config.KnownKeys[disk.ID] = fingerprint
+	pinningMutex.Unlock()
+
+	return fingerprint, nil
+}
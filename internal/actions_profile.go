@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+// ActionProfileList prints all config profiles and marks the active one
+func ActionProfileList(config *Config) {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("Name", "Active", "User ID", "Endpoint", "Default disk")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+
+	for _, name := range config.ProfileNames() {
+		profile := config.Profiles[name]
+		active := ""
+		switch {
+		case name == config.ProfileName():
+			profile = &config.Profile
+			active = "*"
+		case name == DefaultProfileName:
+			profile = &config.defaultProfile
+		}
+
+		endpoint := profile.Endpoint
+		if endpoint == "" {
+			endpoint = "(default)"
+		}
+
+		tbl.AddRow(name, active, profile.UserID, endpoint, profile.DefaultDisk)
+	}
+
+	tbl.Print()
+}
+
+// ActionProfileAdd adds a new profile. Its settings are taken from the global flags if they are set in the command line,
+// values of the active profile and other layers are not copied
+func ActionProfileAdd(config *Config) {
+	profile := &Profile{}
+	if IsFlagSet("endpoint") {
+		profile.Endpoint = *Endpoint
+	}
+	if IsFlagSet("public") {
+		profile.PublicKeyFile = *PublicKeyFile
+	}
+	if IsFlagSet("private") {
+		profile.PrivateKeyFile = *PrivateKeyFile
+	}
+	if IsFlagSet("output") {
+		profile.Output = PrintModeFlag
+	}
+	if IsFlagSet("pretty") {
+		profile.Pretty = Pretty
+	}
+
+	err := config.AddProfile(*ProfileAdd, profile)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("Profile %s added. Use -profile=%s -token=<token> to log in", *ProfileAdd, *ProfileAdd)
+}
+
+// ActionProfileUse sets the profile used when -profile flag is not set
+func ActionProfileUse(config *Config) {
+	if !config.HasProfile(*ProfileUse) {
+		PrintError("Profile %s does not exist", *ProfileUse)
+		return
+	}
+
+	config.CurrentProfile = *ProfileUse
+	if *ProfileUse == DefaultProfileName {
+		config.CurrentProfile = ""
+	}
+
+	Print("Profile %s is used by default now", *ProfileUse)
+}
+
+// ActionProfileRemove removes the profile with all its settings
+func ActionProfileRemove(config *Config) {
+	if !Confirm("Remove profile " + *ProfileRemove + " with its token?") {
+		PrintError("Removal is not confirmed. Use -yes flag to skip confirmation")
+		return
+	}
+
+	err := config.RemoveProfile(*ProfileRemove)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("Profile %s removed", *ProfileRemove)
+}
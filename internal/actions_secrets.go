@@ -0,0 +1,25 @@
+package internal
+
+// ActionSecretsSeal moves plain text tokens into the encrypted secrets store.
+// The secret helper is saved first, so it can provide the passphrase for sealing
+func ActionSecretsSeal(config *Config) {
+	if *SecretsHelper != "" {
+		config.SecretHelper = *SecretsHelper
+	}
+	if *SecretsPasswd && *Passwd == "" {
+		PrintError("Disk password is not provided. Use -passwd flag or KT_CLI_PASSWD environment variable")
+		return
+	}
+	if *NoConfigSave {
+		PrintError("Secrets can't be sealed with -no-save flag")
+		return
+	}
+
+	count, err := config.SealAll(*SecretsPasswd)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("Secrets are sealed (%d tokens moved to the store)", count)
+}
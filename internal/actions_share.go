@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"github.com/rodaine/table"
+	"github.com/skip2/go-qrcode"
+)
+
+// ActionShareCreate enables public access to the file and prints its link
+func ActionShareCreate(config *Config) {
+	file, err := pkg.ShareFile(config.Token, *ShareCreate)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	link := pkg.ShareURL(file)
+	if link == "" {
+		PrintError("File %s is not shared", *ShareCreate)
+		return
+	}
+	Print(link)
+
+	if *ShareQR {
+		printQRCode(link)
+	}
+}
+
+// ActionShareRevoke disables public access to the file
+func ActionShareRevoke(config *Config) {
+	_, err := pkg.RevokeFileShare(config.Token, *ShareRevoke)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("Public link of %s is revoked", *ShareRevoke)
+}
+
+// ActionShareList prints all shared files of the disk, it's useful to audit what is publicly exposed
+func ActionShareList(config *Config) {
+	disk, _, err := DiskIdOrDefault(config, *ShareList)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	files, err := pkg.GetSharedFiles(config.Token, disk)
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+	if len(files) == 0 {
+		Print("There are no shared files on the disk")
+		return
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("ID", "Path", "Name", "Link")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+
+	for _, file := range files {
+		tbl.AddRow(file.ID, file.Path, file.Name, pkg.ShareURL(file.File))
+	}
+
+	tbl.Print()
+}
+
+// printQRCode prints the text as QR code made of unicode blocks. It's printed as-is, ignoring the print mode
+func printQRCode(text string) {
+	code, err := qrcode.New(text, qrcode.Medium)
+	if err != nil {
+		PrintError("Failed to generate QR code: %s", err.Error())
+		return
+	}
+
+	fmt.Print(code.ToSmallString(false))
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"hash"
+	"strings"
+	"time"
+)
+
+// ActionStat prints all metadata of the file found by ID or by path, as lines or as JSON in JSON mode
+func ActionStat(config *Config) {
+	var file *pkg.File
+	var err error
+
+	if strings.Contains(*Stat, "/") {
+		disk, _, diskErr := DiskIdOrDefault(config, *StatDisk)
+		if diskErr != nil {
+			PrintError(diskErr.Error())
+			return
+		}
+		file, err = pkg.FindFileByPath(config.Token, disk, *Stat)
+	} else {
+		file, err = pkg.GetFileById(config.Token, *Stat)
+	}
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	folderPath, err := pkg.GetFolderPath(config.Token, file.Folder)
+	if err != nil {
+		folderPath = "unknown (" + err.Error() + ")"
+	}
+
+	checksum := ""
+	if *StatChecksum != "" {
+		checksum, err = fileChecksum(config, file.ID, *StatChecksum)
+		if err != nil {
+			PrintError(err.Error())
+			return
+		}
+	}
+
+	if IsJsonMode() {
+		info, err := pkg.StructToMap(file)
+		if err != nil {
+			PrintError(err.Error())
+			return
+		}
+		info["path"] = folderPath
+		info["link"] = pkg.ShareURL(file)
+		if checksum != "" {
+			info[strings.ToLower(*StatChecksum)] = checksum
+		}
+
+		PrintJson(info)
+		return
+	}
+
+	Print("ID: %s", file.ID)
+	Print("Name: %s", file.Name)
+	Print("Encrypted name: %s", file.NameCrypto)
+	Print("Disk: %s", file.Disk)
+	Print("Folder: %s", file.Folder)
+	Print("Path: %s", folderPath)
+	Print("Type: %s (%s)", file.Type, file.TypeDesc)
+	Print("MIME: %s", file.Mime)
+	Print("Size: %s (%d bytes)", ByteCount(int64(file.Size)), file.Size)
+	Print("Encrypted: %t", file.Encrypted)
+	Print("Date: %s", time.Unix(int64(file.Date), 0).Format(time.DateTime))
+	Print("Rating: %d", file.Rating)
+	Print("Text: %s", file.Text)
+	Print("Shared: %t", file.URLShared)
+	if link := pkg.ShareURL(file); link != "" {
+		Print("Link: %s", link)
+	}
+	if checksum != "" {
+		Print("%s: %s", strings.ToUpper(*StatChecksum), checksum)
+	}
+}
+
+// fileChecksum streams the file contents into the hash and returns it in hex. Encrypted files are hashed after decryption
+func fileChecksum(config *Config, fileId string, algorithm string) (string, error) {
+	var hasher hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		hasher = md5.New()
+	case "sha1":
+		hasher = sha1.New()
+	case "sha256":
+		hasher = sha256.New()
+	default:
+		return "", fmt.Errorf("unknown checksum algorithm %s", algorithm)
+	}
+
+	_, _, err := pkg.DownloadFile(config.Token, fileId, hasher, NewDefaultCryptoInfo())
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// agentKey is the unlocked key kept by the agent. It's stored in binary form to be wiped when forgotten,
+// the password is never given to the agent
+type agentKey struct {
+	encryptedKey string
+	key          []byte
+	timer        *time.Timer
+}
+
+// wipe overwrites the key
+func (k *agentKey) wipe() {
+	wipeBytes(k.key)
+}
+
+// wipeBytes overwrites the secret with zeros
+func wipeBytes(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+}
+
+// keyAgent keeps unlocked keys by endpoint and disk ID
+type keyAgent struct {
+	mutex    sync.Mutex
+	keys     map[string]*agentKey
+	lifetime time.Duration
+}
+
+// ActionAgent runs the key agent in the foreground until it is interrupted.
+// Keys are forgotten after -act.agent.timeout since they were added
+func ActionAgent() {
+	socket := pkg.AgentSocket()
+	if socket == "" {
+		PrintError("Key agent is disabled by -no-agent flag")
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		PrintError("Failed to create socket directory: %s", err.Error())
+		return
+	}
+	if err := pkg.CheckAgentDir(socket); err != nil {
+		PrintError("Socket directory is not safe: %s", err.Error())
+		return
+	}
+	if pkg.IsAgentRunning() {
+		PrintError("Key agent is already running on %s", socket)
+		return
+	}
+
+	// The socket file may be left by an agent which was killed
+	_ = os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		PrintError("Failed to listen on %s: %s", socket, err.Error())
+		return
+	}
+	_ = os.Chmod(socket, 0600)
+
+	if err = lockAgentMemory(); err != nil {
+		PrintError("WARNING: failed to lock memory, keys may be swapped to disk: %s", err.Error())
+	}
+
+	agent := &keyAgent{keys: make(map[string]*agentKey), lifetime: *AgentTimeout}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		_ = listener.Close()
+	}()
+
+	Print("Key agent is listening on %s", socket)
+	if socket != pkg.DefaultAgentSocket() {
+		Print("Set KT_CLI_AGENT_SOCKET=%s to use it", socket)
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+		go agent.serve(conn)
+	}
+
+	agent.forgetAll()
+	_ = os.Remove(socket)
+	Print("Key agent is stopped")
+}
+
+// serve reads one request from the connection and writes the response
+func (a *keyAgent) serve(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := &pkg.AgentRequest{}
+	response := &pkg.AgentResponse{}
+	if err := json.NewDecoder(conn).Decode(request); err != nil {
+		response.Error = "bad request"
+	} else if err = a.handle(request, response); err != nil {
+		response.Error = err.Error()
+	}
+
+	_ = json.NewEncoder(conn).Encode(response)
+
+	// The key is a copy made under the lock, the agent's own slice may be wiped by then
+	wipeBytes(response.Key)
+}
+
+// handle performs the request
+func (a *keyAgent) handle(request *pkg.AgentRequest, response *pkg.AgentResponse) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	id := request.Endpoint + " " + request.Disk
+	switch request.Op {
+	case pkg.AgentOpPing:
+		return nil
+
+	case pkg.AgentOpAdd:
+		if request.Disk == "" || len(request.Key) == 0 {
+			return errors.New("disk and key are required")
+		}
+
+		// The key is decoded from the request into its own slice, so it's kept without copies
+		a.forget(id)
+		key := &agentKey{encryptedKey: request.EncryptedKey, key: request.Key}
+		if a.lifetime > 0 {
+			key.timer = time.AfterFunc(a.lifetime, func() {
+				a.mutex.Lock()
+				defer a.mutex.Unlock()
+
+				if a.keys[id] == key {
+					a.forget(id)
+				}
+			})
+		}
+		a.keys[id] = key
+		return nil
+
+	case pkg.AgentOpGet:
+		key, ok := a.keys[id]
+		if !ok {
+			return errors.New("key agent has no key of the disk")
+		}
+
+		response.EncryptedKey = key.encryptedKey
+		// The key may be wiped by the timer or forgotten while the response is encoded, so it's copied
+		response.Key = append([]byte(nil), key.key...)
+		return nil
+
+	case pkg.AgentOpForget:
+		for keyId := range a.keys {
+			a.forget(keyId)
+		}
+		return nil
+	}
+
+	return errors.New("unknown operation")
+}
+
+// forget wipes and removes the key. The mutex must be locked
+func (a *keyAgent) forget(id string) {
+	key, ok := a.keys[id]
+	if !ok {
+		return
+	}
+
+	if key.timer != nil {
+		key.timer.Stop()
+	}
+	key.wipe()
+	delete(a.keys, id)
+}
+
+// forgetAll wipes all keys before the agent exits
+func (a *keyAgent) forgetAll() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for id := range a.keys {
+		a.forget(id)
+	}
+}
+
+// ActionAgentForget removes all keys from the running key agent
+func ActionAgentForget() {
+	err := pkg.AgentForgetKeys()
+	if err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	Print("All keys are removed from key agent")
+}
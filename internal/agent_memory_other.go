@@ -0,0 +1,10 @@
+//go:build !unix
+
+package internal
+
+import "errors"
+
+// lockAgentMemory is not supported on this platform
+func lockAgentMemory() error {
+	return errors.New("memory locking is not supported on this platform")
+}
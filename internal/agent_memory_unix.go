@@ -0,0 +1,10 @@
+//go:build unix
+
+package internal
+
+import "golang.org/x/sys/unix"
+
+// lockAgentMemory keeps the memory of the agent process out of swap, so unlocked keys are never written to disk
+func lockAgentMemory() error {
+	return unix.Mlockall(unix.MCL_CURRENT | unix.MCL_FUTURE)
+}
@@ -1,6 +1,9 @@
 package internal
 
-import "github.com/kt-soft-dev/kt-cli/pkg"
+import (
+	"errors"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+)
 
 // CheckTokenAndAssign checks if the token is valid and assigns it to the config.
 // It's a wrapper around CheckToken
@@ -8,7 +11,7 @@ func CheckTokenAndAssign(token string, config *Config) error {
 	id, err := CheckToken(token)
 	if err != nil {
 		PrintError(err.Error())
-		return nil
+		return err
 	}
 
 	Print("Logged in as user id %s", id)
@@ -28,3 +31,41 @@ func CheckToken(token string) (string, error) {
 
 	return id, nil
 }
+
+// ExitCodeAuthFailed is the exit code used when the token is rejected by the API and can't be renewed
+const ExitCodeAuthFailed = 3
+
+// authFailed is set when the token was rejected and wasn't renewed
+var authFailed bool
+
+// IsAuthFailed checks if the token was rejected by the API during the execution and wasn't renewed
+func IsAuthFailed() bool {
+	return authFailed
+}
+
+// SetupTokenRenewing makes the library ask for a new token once when the API rejects the current one,
+// so the failed operation is retried transparently. The new token is validated and saved to the config.
+// In non-interactive mode nothing is asked, the failure is only recorded (see IsAuthFailed)
+func SetupTokenRenewing(config *Config) {
+	pkg.SetTokenRenewer(func(expiredToken string) (string, error) {
+		if *NotInteractive {
+			authFailed = true
+			return "", errors.New("token is rejected")
+		}
+
+		PrintError("Your access token is expired or revoked")
+		token, err := ReadSecret("Enter a new access token or leave it blank to log in with email and password: ")
+		if err == nil && token == "" {
+			token, err = loginWithPassword()
+		}
+		if err == nil {
+			err = CheckTokenAndAssign(token, config)
+		}
+		if err != nil {
+			authFailed = true
+			return "", err
+		}
+
+		return token, nil
+	})
+}
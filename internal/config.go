@@ -1,50 +1,446 @@
 package internal
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"os"
+	"path/filepath"
+	"sort"
 )
 
-// Config represents the structure of global configuration
-type Config struct {
+// DefaultProfileName is the name of the profile stored at the top level of the config file
+const DefaultProfileName = "default"
+
+// ConfigVersion is the version of the config file format written by this client.
+// Increase it and add a migration to migrateConfig when the format changes incompatibly
+const ConfigVersion = 1
+
+// Profile is a set of settings for one account and environment
+type Profile struct {
 	UserID string `yaml:"user_id"`
 	Token  string `yaml:"token"`
+	// Endpoint is the base url of the API. The official server is used if empty
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// DefaultDisk is the disk id or title used when no disk is provided. The first user's disk is used if empty
+	DefaultDisk string `yaml:"default_disk"`
+	// DefaultFolder is the folder id used for uploads when no folder is provided. The root folder is used if empty
+	DefaultFolder string `yaml:"default_folder,omitempty"`
+	// PublicKeyFile and PrivateKeyFile replace the default values of -public and -private flags
+	PublicKeyFile  string `yaml:"public_key_file,omitempty"`
+	PrivateKeyFile string `yaml:"private_key_file,omitempty"`
+	// Output and Pretty replace the default values of -output and -pretty flags
+	Output *int  `yaml:"output,omitempty"`
+	Pretty *bool `yaml:"pretty,omitempty"`
+	// Concurrency is the number of files uploaded at the same time from a directory
+	Concurrency *int `yaml:"concurrency,omitempty"`
+	// Retries and RetryDelay set the retry policy of API requests, see pkg.SetRetryPolicy
+	Retries    *int   `yaml:"retries,omitempty"`
+	RetryDelay string `yaml:"retry_delay,omitempty"`
+	// KnownKeys maps disk IDs to fingerprints of their public keys pinned on first use, see pinning.go
+	KnownKeys map[string]string `yaml:"known_keys,omitempty"`
+	// EncryptNames replaces the default value of -encrypt-names flag
+	EncryptNames *bool `yaml:"encrypt_names,omitempty"`
+	// Signatures is the signature policy replacing the default value of -signatures flag
+	Signatures string `yaml:"signatures,omitempty"`
+	// Sealed is the token and optionally the disk password encrypted with a passphrase, see secrets.go
+	Sealed string `yaml:"sealed,omitempty"`
+	// SecretHelper is a shell command printing the passphrase for Sealed secrets
+	SecretHelper string `yaml:"secret_helper,omitempty"`
+}
+
+// ClearCredentials removes the token, the user id and the sealed secrets of the profile
+func (p *Profile) ClearCredentials() {
+	p.Token = ""
+	p.UserID = ""
+	p.Sealed = ""
+}
+
+// Config represents the structure of global configuration.
+// The embedded Profile is always the active profile, so the rest of the code doesn't need to know about profiles.
+// The default profile is stored at the top level of the file to stay compatible with old config files
+type Config struct {
+	// Version is the version of the file format, see ConfigVersion. Files without it are version 0
+	Version        int `yaml:"version"`
+	Profile        `yaml:",inline"`
+	CurrentProfile string              `yaml:"current_profile,omitempty"`
+	Profiles       map[string]*Profile `yaml:"profiles,omitempty"`
+
+	// profileName is the name of the active profile
+	profileName string
+	// defaultProfile keeps the default profile while another profile is active
+	defaultProfile Profile
+	// passphrase is set when secrets of the active profile are unlocked or should be sealed on saving
+	passphrase []byte
+	// sealedPasswd is the disk password stored in the sealed secrets of the active profile
+	sealedPasswd string
+	// unsealed keeps the secrets as they were unsealed, so they are sealed again only if changed
+	unsealed sealedSecrets
+	// passphrases are the secrets store passphrases resolved during the execution, see passphraseCache
+	passphrases passphraseCache
+	// loaded is the config file content as it was loaded, it's the base for merging concurrent changes
+	loaded []byte
 }
 
 // CreateDefaultConfig creates an empty configuration
 func CreateDefaultConfig() *Config {
-	return &Config{}
+	return &Config{Version: ConfigVersion}
 }
 
-// LoadConfig loads the configuration from a YAML file or creates the empty one
+// LoadConfig loads the configuration from a YAML file or creates the empty one if the file doesn't exist.
+// The empty configuration is not written until something is changed
 func LoadConfig(filename string) (*Config, error) {
+	config := CreateDefaultConfig()
+
 	data, err := os.ReadFile(filename)
+	if err == nil {
+		config = &Config{}
+		err = yaml.Unmarshal(data, config)
+		if err != nil {
+			return nil, err
+		}
+
+		// Old versions created world-readable configs, but the file contains the token
+		if info, err := os.Stat(filename); err == nil && info.Mode().Perm()&0077 != 0 {
+			_ = os.Chmod(filename, 0600)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// The loaded state is kept to detect changes and to merge them with changes made by other processes.
+	// It's taken before the migration, so the migrated config is saved
+	config.loaded, err = config.marshal()
 	if err != nil {
-		defaultConf := CreateDefaultConfig()
-		_ = SaveConfig(defaultConf, filename)
-		return defaultConf, nil
+		return nil, err
 	}
 
-	var config Config
-	err = yaml.Unmarshal(data, &config)
+	err = config.migrate()
 	if err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	return config, nil
 }
 
-// SaveConfig saves the configuration to a YAML file
+// migrate upgrades the config loaded from an older file format to ConfigVersion
+func (c *Config) migrate() error {
+	if c.Version > ConfigVersion {
+		return fmt.Errorf("config file version %d is newer than supported version %d, update the client", c.Version, ConfigVersion)
+	}
+
+	// Version 0 didn't have the version field, otherwise it is the same as version 1
+	if c.Version == 0 {
+		c.Version = 1
+	}
+
+	return nil
+}
+
+// SaveConfig saves the configuration to a YAML file if it was changed since loading.
+// Other processes could change the file in the meantime, so the file is locked, and the changes are merged.
+// The file is replaced atomically and readable only by the owner, because it contains the token
 func SaveConfig(config *Config, filename string) error {
-	data, err := yaml.Marshal(config)
+	data, err := config.marshal()
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, config.loaded) {
+		return nil
+	}
+
+	// Keep the symlink to the config in place, the file it points to is replaced instead
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = resolved
+	}
+
+	// The directory is created for the default location in the user config directory
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockConfig(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := os.ReadFile(filename)
+	if err == nil {
+		data, err = mergeConfig(config.loaded, data, current)
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	err = writeFileAtomic(filename, data)
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(filename, data, 0644)
+	config.loaded = data
+	return nil
+}
+
+// marshal returns the config as it is stored in the file
+func (c *Config) marshal() ([]byte, error) {
+	view, err := c.fileView()
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(view)
+}
+
+// lockConfig takes the lock of the config file and returns the function releasing it.
+// The lock is held on a separate file, because the config file itself is replaced on saving
+func lockConfig(filename string) (func(), error) {
+	file, err := os.OpenFile(filename+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to lock config file: %w", err)
+	}
+
+	return func() {
+		_ = unlockFile(file)
+		_ = file.Close()
+	}, nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory and renames it to the filename,
+// so other processes never see a partially written file
+func writeFileAtomic(filename string, data []byte) error {
+	file, err := createFileAtomic(filename, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	return file.commit(err)
+}
+
+// atomicFile is a temporary file in the directory of the target file. The target is replaced only when the temporary
+// file is completely written, so an existing file is kept if writing fails
+type atomicFile struct {
+	*os.File
+	filename string
+	perm     os.FileMode
+}
+
+// createFileAtomic creates the temporary file for the target file, see atomicFile
+func createFileAtomic(filename string, perm os.FileMode) (*atomicFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &atomicFile{File: file, filename: filename, perm: perm}, nil
+}
+
+// commit renames the temporary file to the target if err is nil, otherwise the temporary file is removed.
+// The error of writing or of the commit is returned
+func (f *atomicFile) commit(err error) error {
+	tmpName := f.Name()
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// CreateTemp uses 0600, but umask or the platform could change it
+		err = os.Chmod(tmpName, f.perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpName, f.filename)
+	}
 	if err != nil {
+		_ = os.Remove(tmpName)
 		return err
 	}
 
 	return nil
 }
+
+// fileView returns the copy of the config as it is stored in the file: the default profile at the top level,
+// the active named profile in the profiles map, and secrets of the active profile sealed if the store is used
+func (c *Config) fileView() (*Config, error) {
+	view := *c
+	active := c.Profile
+	if err := c.sealActive(&active); err != nil {
+		return nil, err
+	}
+
+	if c.ProfileName() == DefaultProfileName {
+		view.Profile = active
+		return &view, nil
+	}
+
+	view.Profile = c.defaultProfile
+	view.Profiles = make(map[string]*Profile, len(c.Profiles))
+	for name, profile := range c.Profiles {
+		view.Profiles[name] = profile
+	}
+	view.Profiles[c.profileName] = &active
+
+	return &view, nil
+}
+
+// applyFileView replaces the stored settings with the ones from the config as it is stored in the file (see fileView),
+// e.g. after it's edited by hand. The active profile stays selected, and its unlocked secrets are kept unless
+// the sealed value has been changed
+func (c *Config) applyFileView(view *Config) error {
+	active := &view.Profile
+	if c.ProfileName() != DefaultProfileName {
+		active = view.Profiles[c.profileName]
+		if active == nil {
+			return fmt.Errorf("the active profile %s can't be removed", c.profileName)
+		}
+	}
+
+	if active.Sealed != c.Sealed {
+		// Secrets are sealed with another passphrase or removed, they are saved as they are in the file
+		c.passphrase = nil
+		c.unsealed = sealedSecrets{}
+		c.sealedPasswd = ""
+	} else if active.Sealed != "" {
+		// The token is sealed in the file, the unsealed one is kept
+		active.Token = c.Token
+	}
+
+	c.Version = view.Version
+	c.CurrentProfile = view.CurrentProfile
+	c.Profiles = view.Profiles
+	if c.ProfileName() == DefaultProfileName {
+		c.Profile = view.Profile
+	} else {
+		c.defaultProfile = view.Profile
+		c.Profile = *active
+	}
+
+	return nil
+}
+
+// ProfileName returns the name of the active profile
+func (c *Config) ProfileName() string {
+	if c.profileName == "" {
+		return DefaultProfileName
+	}
+
+	return c.profileName
+}
+
+// ProfileNames returns the names of all profiles including the default one, sorted
+func (c *Config) ProfileNames() []string {
+	names := []string{DefaultProfileName}
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	return names
+}
+
+// HasProfile checks if the profile with the name exists
+func (c *Config) HasProfile(name string) bool {
+	if name == DefaultProfileName {
+		return true
+	}
+
+	_, ok := c.Profiles[name]
+	return ok
+}
+
+// SelectProfile makes the profile with the name active. Empty name selects CurrentProfile or the default profile
+func (c *Config) SelectProfile(name string) error {
+	if name == "" {
+		name = c.CurrentProfile
+	}
+	if name == "" {
+		name = DefaultProfileName
+	}
+	if name == c.ProfileName() {
+		return nil
+	}
+	if !c.HasProfile(name) {
+		return fmt.Errorf("profile %s does not exist", name)
+	}
+
+	// Store the active profile back before switching
+	if c.ProfileName() == DefaultProfileName {
+		c.defaultProfile = c.Profile
+	} else {
+		active := c.Profile
+		c.Profiles[c.profileName] = &active
+	}
+
+	if name == DefaultProfileName {
+		c.Profile = c.defaultProfile
+	} else {
+		c.Profile = *c.Profiles[name]
+	}
+	c.profileName = name
+
+	return nil
+}
+
+// inactiveProfiles returns all profiles except the active one. The changes of returned profiles are saved
+func (c *Config) inactiveProfiles() []*Profile {
+	var profiles []*Profile
+	for name, profile := range c.Profiles {
+		if profile != nil && name != c.ProfileName() {
+			profiles = append(profiles, profile)
+		}
+	}
+	if c.ProfileName() != DefaultProfileName {
+		profiles = append(profiles, &c.defaultProfile)
+	}
+
+	return profiles
+}
+
+// AddProfile adds a new named profile
+func (c *Config) AddProfile(name string, profile *Profile) error {
+	if name == "" {
+		return errors.New("profile name is required")
+	}
+	if c.HasProfile(name) {
+		return fmt.Errorf("profile %s already exists", name)
+	}
+
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]*Profile)
+	}
+	c.Profiles[name] = profile
+
+	return nil
+}
+
+// RemoveProfile removes the named profile. The default and the active profiles can't be removed
+func (c *Config) RemoveProfile(name string) error {
+	if name == DefaultProfileName {
+		return errors.New("the default profile can't be removed")
+	}
+	if name == c.ProfileName() {
+		return errors.New("the active profile can't be removed, select another one with -profile flag")
+	}
+	if !c.HasProfile(name) {
+		return fmt.Errorf("profile %s does not exist", name)
+	}
+
+	delete(c.Profiles, name)
+	if c.CurrentProfile == name {
+		c.CurrentProfile = ""
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package internal
+
+import "os"
+
+// lockFile does nothing on platforms without file locking, concurrent changes are still merged on saving
+func lockFile(*os.File) error {
+	return nil
+}
+
+// unlockFile does nothing on platforms without file locking
+func unlockFile(*os.File) error {
+	return nil
+}
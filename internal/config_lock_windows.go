@@ -0,0 +1,20 @@
+//go:build windows
+
+package internal
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+// lockFile takes the exclusive lock of the file, waiting for other processes to release it
+func lockFile(file *os.File) error {
+	overlapped := &windows.Overlapped{}
+	return windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, overlapped)
+}
+
+// unlockFile releases the lock taken by lockFile
+func unlockFile(file *os.File) error {
+	overlapped := &windows.Overlapped{}
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, overlapped)
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"gopkg.in/yaml.v2"
+	"reflect"
+)
+
+// mergeConfig merges the config changed by this process (ours) with the file changed by other processes (theirs)
+// since it was loaded (base). Values changed only on one side are taken from that side,
+// values changed on both sides are taken from ours, because it was saved later
+func mergeConfig(base, ours, theirs []byte) ([]byte, error) {
+	maps := make([]map[interface{}]interface{}, 3)
+	for i, data := range [][]byte{base, ours, theirs} {
+		if err := yaml.Unmarshal(data, &maps[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	merged, err := yaml.Marshal(mergeMaps(maps[0], maps[1], maps[2]))
+	if err != nil {
+		return nil, err
+	}
+
+	// Round trip through Config keeps the order of keys the same as in files written without merging
+	var config Config
+	if err = yaml.Unmarshal(merged, &config); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(&config)
+}
+
+// mergeMaps does three-way merge of YAML maps, nested maps are merged key by key
+func mergeMaps(base, ours, theirs map[interface{}]interface{}) map[interface{}]interface{} {
+	merged := make(map[interface{}]interface{})
+	keys := make(map[interface{}]bool)
+	for _, m := range []map[interface{}]interface{}{base, ours, theirs} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+
+	for key := range keys {
+		baseValue, inBase := base[key]
+		oursValue, inOurs := ours[key]
+		theirsValue, inTheirs := theirs[key]
+
+		oursChanged := inOurs != inBase || !reflect.DeepEqual(oursValue, baseValue)
+		theirsChanged := inTheirs != inBase || !reflect.DeepEqual(theirsValue, baseValue)
+
+		switch {
+		case !oursChanged:
+			if inTheirs {
+				merged[key] = theirsValue
+			}
+		case !theirsChanged:
+			if inOurs {
+				merged[key] = oursValue
+			}
+		default:
+			baseNested, _ := baseValue.(map[interface{}]interface{})
+			oursNested, oursIsMap := oursValue.(map[interface{}]interface{})
+			theirsNested, theirsIsMap := theirsValue.(map[interface{}]interface{})
+			if oursIsMap && theirsIsMap {
+				merged[key] = mergeMaps(baseNested, oursNested, theirsNested)
+			} else if inOurs {
+				merged[key] = oursValue
+			}
+		}
+	}
+
+	return merged
+}
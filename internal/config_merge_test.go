@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"testing"
+)
+
+func TestMergeMaps(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		ours   string
+		theirs string
+		want   string
+	}{
+		{"unchanged", "a: 1\nb: 2", "a: 1\nb: 2", "a: 1\nb: 2", "a: 1\nb: 2"},
+		{"changed by us", "a: 1\nb: 2", "a: 3\nb: 2", "a: 1\nb: 2", "a: 3\nb: 2"},
+		{"changed by them", "a: 1\nb: 2", "a: 1\nb: 2", "a: 1\nb: 4", "a: 1\nb: 4"},
+		{"changed by both in different keys", "a: 1\nb: 2", "a: 3\nb: 2", "a: 1\nb: 4", "a: 3\nb: 4"},
+		{"changed by both in the same key", "a: 1", "a: 3", "a: 4", "a: 3"},
+		{"same change on both sides", "a: 1", "a: 3", "a: 3", "a: 3"},
+		{"added by us", "a: 1", "a: 1\nb: 2", "a: 1", "a: 1\nb: 2"},
+		{"added by them", "a: 1", "a: 1", "a: 1\nb: 2", "a: 1\nb: 2"},
+		{"added by both", "a: 1", "a: 1\nb: 2", "a: 1\nb: 3", "a: 1\nb: 2"},
+		{"removed by us", "a: 1\nb: 2", "a: 1", "a: 1\nb: 2", "a: 1"},
+		{"removed by them", "a: 1\nb: 2", "a: 1\nb: 2", "a: 1", "a: 1"},
+		{"removed by us and changed by them", "a: 1\nb: 2", "a: 1", "a: 1\nb: 3", "a: 1"},
+		{"changed by us and removed by them", "a: 1\nb: 2", "a: 1\nb: 3", "a: 1", "a: 1\nb: 3"},
+		{"no base", "", "a: 1", "b: 2", "a: 1\nb: 2"},
+		{
+			"nested maps",
+			"profiles:\n  work:\n    token: old\n    output: 1",
+			"profiles:\n  work:\n    token: new\n    output: 1",
+			"profiles:\n  work:\n    token: old\n    output: 1\n  home:\n    token: home",
+			"profiles:\n  work:\n    token: new\n    output: 1\n  home:\n    token: home",
+		},
+		{
+			"nested maps changed in the same key",
+			"profiles:\n  work:\n    output: 1",
+			"profiles:\n  work:\n    output: 2",
+			"profiles:\n  work:\n    output: 3",
+			"profiles:\n  work:\n    output: 2",
+		},
+		{
+			"map replaced by a value",
+			"profiles:\n  work:\n    output: 1",
+			"profiles:\n  work:\n    output: 2",
+			"profiles: none",
+			"profiles:\n  work:\n    output: 2",
+		},
+	}
+
+	parse := func(t *testing.T, data string) map[interface{}]interface{} {
+		var result map[interface{}]interface{}
+		if err := yaml.Unmarshal([]byte(data), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result == nil {
+			result = make(map[interface{}]interface{})
+		}
+		return result
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := mergeMaps(parse(t, test.base), parse(t, test.ours), parse(t, test.theirs))
+			want := parse(t, test.want)
+			if !reflect.DeepEqual(merged, want) {
+				got, _ := yaml.Marshal(merged)
+				t.Errorf("merged:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigKey describes a profile setting managed by -act.config.* actions. The key is the YAML name of the Profile field
+type ConfigKey struct {
+	Name        string
+	Description string
+	// Secret values are hidden in listings
+	Secret bool
+	// ReadOnly keys are managed by the client itself and can't be changed by -act.config.set
+	ReadOnly bool
+	// Validate checks the value before it is set, nil means any value of the field type is valid
+	Validate func(value string) error
+}
+
+// ConfigKeys is the schema of profile settings
+var ConfigKeys = []ConfigKey{
+	{Name: "user_id", Description: "ID of the logged in user", ReadOnly: true},
+	{Name: "token", Description: "Access token", Secret: true, ReadOnly: true},
+	{Name: "sealed", Description: "Encrypted secrets store", Secret: true, ReadOnly: true},
+	{Name: "endpoint", Description: "Base url of the API server", Validate: validateEndpoint},
+	{Name: "default_disk", Description: "Disk ID or title used when no disk is provided"},
+	{Name: "default_folder", Description: "Folder ID used for uploads when no folder is provided"},
+	{Name: "output", Description: "Output mode (0 - log with timestamp, 1 - plain log, 2 - no newline, 3 - data as JSON)",
+		Validate: validateIntRange(ModeLog, ModeJson)},
+	{Name: "pretty", Description: "Pretty-print JSON responses"},
+	{Name: "public_key_file", Description: "Public key file path"},
+	{Name: "private_key_file", Description: "Private key file path"},
+	{Name: "concurrency", Description: "Number of files uploaded at the same time from a directory",
+		Validate: validateIntRange(1, 32)},
+	{Name: "retries", Description: "How many times failed API requests are repeated", Validate: validateIntRange(0, 10)},
+	{Name: "retry_delay", Description: "Delay before the first repeat of a failed request, like 500ms or 2s",
+		Validate: validateDuration},
+	{Name: "encrypt_names", Description: "Encrypt names of uploaded encrypted files"},
+	{Name: "signatures", Description: "Signature policy: warn, require or off", Validate: validateSignaturePolicy},
+	{Name: "secret_helper", Description: "Shell command printing the secrets store passphrase"},
+}
+
+// FindConfigKey returns the schema of the key. Dashes are accepted instead of underscores
+func FindConfigKey(name string) (*ConfigKey, error) {
+	name = strings.ReplaceAll(strings.TrimSpace(name), "-", "_")
+	for i := range ConfigKeys {
+		if ConfigKeys[i].Name == name {
+			return &ConfigKeys[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown config key %s", name)
+}
+
+// field returns the Profile field with the key's YAML name
+func (k *ConfigKey) field(profile *Profile) (reflect.Value, error) {
+	value := reflect.ValueOf(profile).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		tag, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("yaml"), ",")
+		if tag == k.Name {
+			return value.Field(i), nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("config key %s has no field in profile", k.Name)
+}
+
+// Get returns the value of the key in the profile and whether it is set
+func (k *ConfigKey) Get(profile *Profile) (string, bool, error) {
+	field, err := k.field(profile)
+	if err != nil {
+		return "", false, err
+	}
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return "", false, nil
+		}
+		field = field.Elem()
+	}
+
+	value := fmt.Sprint(field.Interface())
+	return value, field.Kind() != reflect.String || value != "", nil
+}
+
+// Set validates the value, converts it to the field type and sets it in the profile
+func (k *ConfigKey) Set(profile *Profile, value string) error {
+	if k.ReadOnly {
+		return fmt.Errorf("%s can't be changed by hand", k.Name)
+	}
+
+	return k.set(profile, value)
+}
+
+// set is Set without the read-only check, it is used to validate values loaded from the file
+func (k *ConfigKey) set(profile *Profile, value string) error {
+	if k.Validate != nil {
+		if err := k.Validate(value); err != nil {
+			return fmt.Errorf("invalid value of %s: %w", k.Name, err)
+		}
+	}
+
+	field, err := k.field(profile)
+	if err != nil {
+		return err
+	}
+
+	switch field.Type() {
+	case reflect.TypeOf(""):
+		field.SetString(value)
+	case reflect.TypeOf((*int)(nil)):
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s should be a number", k.Name)
+		}
+		field.Set(reflect.ValueOf(&number))
+	case reflect.TypeOf((*bool)(nil)):
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s should be true or false", k.Name)
+		}
+		field.Set(reflect.ValueOf(&flag))
+	default:
+		return fmt.Errorf("unsupported type of config key %s", k.Name)
+	}
+
+	return nil
+}
+
+// Unset removes the key from the profile, so the default value is used
+func (k *ConfigKey) Unset(profile *Profile) error {
+	if k.ReadOnly {
+		return fmt.Errorf("%s can't be changed by hand", k.Name)
+	}
+
+	field, err := k.field(profile)
+	if err != nil {
+		return err
+	}
+
+	field.Set(reflect.Zero(field.Type()))
+	return nil
+}
+
+// Validate checks all settings of all profiles against the schema
+func (c *Config) Validate() error {
+	profiles := map[string]*Profile{DefaultProfileName: &c.Profile}
+	for name, profile := range c.Profiles {
+		if profile == nil {
+			return fmt.Errorf("profile %s is empty", name)
+		}
+		profiles[name] = profile
+	}
+
+	for name, profile := range profiles {
+		if err := validateProfile(profile); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateProfile checks the settings of the profile against the schema
+func validateProfile(profile *Profile) error {
+	for i := range ConfigKeys {
+		key := &ConfigKeys[i]
+		value, ok, err := key.Get(profile)
+		if err != nil {
+			return err
+		}
+		if !ok || key.Validate == nil {
+			continue
+		}
+
+		// Setting the value to a copy runs the same checks as -act.config.set
+		check := *profile
+		if err = key.set(&check, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateEndpoint checks that the endpoint is an absolute http(s) url
+func validateEndpoint(value string) error {
+	endpoint, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return errors.New("should be http or https url like https://example.com")
+	}
+
+	return nil
+}
+
+// validateIntRange returns the validator checking that the value is a number between min and max
+func validateIntRange(min int, max int) func(string) error {
+	return func(value string) error {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("should be a number")
+		}
+		if number < min || number > max {
+			return fmt.Errorf("should be between %d and %d", min, max)
+		}
+
+		return nil
+	}
+}
+
+// validateDuration checks that the value is a non-negative duration like 500ms or 2s
+func validateDuration(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return errors.New("should be a duration like 500ms or 2s")
+	}
+	if duration < 0 {
+		return errors.New("should not be negative")
+	}
+
+	return nil
+}
+
+// validateSignaturePolicy checks that the value is a known signature policy
+func validateSignaturePolicy(value string) error {
+	_, err := pkg.ParseSignaturePolicy(value)
+	return err
+}
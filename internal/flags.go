@@ -2,7 +2,7 @@ package internal
 
 import (
 	"flag"
-	"os"
+	"time"
 )
 
 var (
@@ -13,43 +13,162 @@ var (
 
 	// Global flags
 
-	ConfigFilename = flag.String("config", "config.yaml", "Set config file path")
-	PrintModeFlag  = flag.Int("output", ModeLog, "Output mode (0 - log with timestamp, 1 - plain log, 2 - no newline)")
+	ConfigFilename = flag.String("config", "", "Set config file path (default is ktcloud/config.yaml in the user config directory, e.g. $XDG_CONFIG_HOME)")
+	ProfileName    = flag.String("profile", "", "Set config profile to use")
+	Endpoint       = flag.String("endpoint", "", "Set API server base url")
+	DiskFlag       = flag.String("disk", "", "Set default disk by ID or title for this run (replaces default_disk from config)")
+	FolderFlag     = flag.String("folder", "", "Set default folder ID for uploads (replaces default_folder from config)")
+	Concurrency    = flag.Int("concurrency", 1, "Set number of files uploaded at the same time from a directory")
+	Retries        = flag.Int("retries", 0, "Set how many times failed API requests are repeated (network errors and server failures)")
+	RetryDelay     = flag.Duration("retry-delay", time.Second, "Set delay before the first repeat of a failed request, it doubles after every attempt")
+	EncryptNames   = flag.Bool("encrypt-names", false, "Encrypt names of uploaded encrypted files, the server stores random placeholders instead")
+	Signatures     = flag.String("signatures", "warn", "Set signature policy: warn - sign uploads if the password is provided and warn about unsigned downloads, require - fail unsigned uploads and reject unsigned or badly signed downloads, off - do not sign or verify")
+	PrintModeFlag  = printModeFlag("output", ModeLog, "Output mode (0 or log - log with timestamp, 1 or plain - plain log, 2 or nonewline - no newline, 3 or json - data as JSON)")
 	NotInteractive = flag.Bool("no-interactive", false, "Do not ask for any input, use default values")
 	NoConfigSave   = flag.Bool("no-save", false, "Do not save the config file on exit (including token)")
-	Auth           = flag.String("token", "", "Set auth token for future requests (will be saved in config file; also you can use environment variable KT_CLI_TOKEN)")
+	AssumeYes      = flag.Bool("yes", false, "Answer yes to all confirmations (e.g. before deleting)")
+	Force          = flag.Bool("force", false, "Overwrite existing files (e.g. exported keys)")
+	Auth           = flag.String("token", "", "Set auth token for future requests (will be saved in config file)")
 	Pretty         = flag.Bool("pretty", false, "Pretty-print JSON responses")
-	Passwd         = flag.String("passwd", "", "Set password for encryption/decryption. Also you can use environment variable KT_CLI_PASSWD")
+	Passwd         = flag.String("passwd", "", "Set password for encryption/decryption")
 	PublicKeyFile  = flag.String("public", "public_key.pub", "Set public key file path for encryption/decryption (will be downloaded from the server if empty)")
 	PrivateKeyFile = flag.String("private", "private_key.asc", "Set private key file path for encryption/decryption (will be downloaded and decrypted from the server if empty)")
+	AgentSocket    = flag.String("agent-socket", "", "Set key agent socket path (default is ktcloud/agent.sock in $XDG_RUNTIME_DIR or in a per-user temporary directory)")
+	NoAgent        = flag.Bool("no-agent", false, "Do not use key agent")
 
 	// Actions to perform
 
 	Method = flag.String("act.method", "", "Call API method")
 	Ping   = flag.Bool("act.ping", false, "Check if API is alive")
+	WhoAmI = flag.Bool("act.whoami", false, "Show account info, disks and used space")
+	Quota  = flag.Bool("act.quota", false, "Show used and available space")
 
-	GetKeys            = flag.String("act.keys", "", "Download keys for the provided disk (\".\" for default disk)")
+	Login      = flag.Bool("act.login", false, "Log in with email and password to get the token")
+	LoginEmail = flag.String("act.login.email", "", "Set email for login (asked if empty)")
+	LoginWeb   = flag.Bool("act.login.web", false, "Log in through the web app in the browser instead of email and password")
+
+	Logout     = flag.Bool("act.logout", false, "Revoke the token and remove it with other secrets from the active profile")
+	LogoutAll  = flag.Bool("act.logout.all", false, "Log out from all profiles")
+	LogoutKeys = flag.Bool("act.logout.keys", false, "Also delete the private key file (-private), it may be the only copy for offline decryption")
+
+	GetKeys            = flag.String("act.keys", "", "Download keys for the provided disk by ID or title (\".\" for default disk)")
 	GetKeysPublicName  = flag.String("act.keys.public", "public_key.pub", "Set public key name for download")
 	GetKeysPrivateName = flag.String("act.keys.private", "private_key.asc", "Set private key name for download")
+	GetKeysRelock      = flag.Bool("act.keys.relock", false, "Lock exported private key with a new passphrase instead of the disk password (asked twice)")
+	GetKeysRelockPass  = flag.String("act.keys.relock.passphrase", "", "Set new passphrase for -act.keys.relock (prefer KT_CLI_ACT_KEYS_RELOCK_PASSPHRASE to the flag)")
+	GetKeysPaper       = flag.String("act.keys.paper", "", "Export private key as a printable paper backup into the file instead of key files")
+	KeysTrust          = flag.String("act.keys.trust", "", "Trust the current public key of the disk by ID or title (\".\" for default disk) after it has changed")
+	KeysPasswd         = flag.String("act.keys.passwd", "", "Change password of the disk by ID or title (\".\" for default disk), the current one is taken from -passwd or asked")
+	KeysPasswdNew      = flag.String("act.keys.passwd.new", "", "Set new disk password for -act.keys.passwd (asked twice if empty, prefer KT_CLI_ACT_KEYS_PASSWD_NEW to the flag)")
+	KeysImport         = flag.String("act.keys.import", "", "Import keys from the private key file exported by -act.keys or from a paper backup into -public and -private files")
+	KeysImportPublic   = flag.String("act.keys.import.public", "", "Set public key file for import (derived from the private key if empty)")
+	KeysImportPass     = flag.String("act.keys.import.passphrase", "", "Set passphrase of the imported key if it differs from the disk password (asked if needed)")
+	KeysGenerate       = flag.String("act.keys.generate", "", "Generate keys for the disk by ID or title (\".\" for default disk) protected with -passwd (asked twice if empty)")
+	KeysRotate         = flag.String("act.keys.rotate", "", "Replace keys of the disk by ID or title (\".\" for default disk) and re-encrypt its files. Re-encryption runs in the foreground (no background mode) and blocks until all files are done, run again to continue interrupted re-encryption")
+	KeysRotateFiles    = flag.Bool("act.keys.rotate.files", true, "Re-encrypt files after the keys are replaced (use =false to do it later)")
+
+	CryptEncrypt = flag.String("act.crypt.encrypt", "", "Encrypt the file (\"-\" for stdin) with the public key file (-public) without connecting to the server")
+	CryptDecrypt = flag.String("act.crypt.decrypt", "", "Decrypt the file (\"-\" for stdin) with the private key file (-private) and -passwd without connecting to the server")
+	CryptOut     = flag.String("act.crypt.out", "", "Set output file for -act.crypt.encrypt and -act.crypt.decrypt (\"-\" for stdout, default is the input with or without .pgp)")
+
+	Agent        = flag.Bool("act.agent", false, "Run key agent keeping unlocked disk keys in memory, so the password is entered once per session")
+	AgentTimeout = flag.Duration("act.agent.timeout", time.Hour, "Set how long key agent keeps each key (0 to keep until it's stopped)")
+	AgentForget  = flag.Bool("act.agent.forget", false, "Remove all keys from the running key agent")
 
 	Download     = flag.String("act.download", "", "Download file by file ID")
 	DownloadPath = flag.String("act.download.path", ".", "Set path to save downloaded file")
 
 	Upload       = flag.String("act.upload", "", "Upload file by path; stdin is also supported")
 	UploadName   = flag.String("act.upload.name", "", "Set file name for upload (required for stdin)")
-	UploadDisk   = flag.String("act.upload.disk", "", "Set disk for upload")
-	UploadFolder = flag.String("act.upload.folder", "", "Set folder for upload")
+	UploadDisk   = flag.String("act.upload.disk", "", "Set disk for upload by ID or title (default disk if empty)")
+	UploadFolder = flag.String("act.upload.folder", "", "Set folder for upload (default folder if empty)")
+
+	ProfileList   = flag.Bool("act.profile.list", false, "List config profiles")
+	ProfileAdd    = flag.String("act.profile.add", "", "Add config profile with -endpoint, -public, -private, -output and -pretty values if set")
+	ProfileUse    = flag.String("act.profile.use", "", "Set profile used by default")
+	ProfileRemove = flag.String("act.profile.remove", "", "Remove config profile")
+
+	ConfigShow       = flag.Bool("act.config.show", false, "Show effective global settings")
+	ConfigShowOrigin = flag.Bool("act.config.show.origin", false, "Also show where each setting came from (command line, environment, config files or default)")
+	ConfigList       = flag.Bool("act.config.list", false, "List settings stored in the active profile (secrets are hidden)")
+	ConfigGet        = flag.String("act.config.get", "", "Print setting of the active profile by key")
+	ConfigSet        = flag.String("act.config.set", "", "Change setting of the active profile (format: key=value)")
+	ConfigUnset      = flag.String("act.config.unset", "", "Remove setting from the active profile by key, the default value is used then")
+	ConfigEdit       = flag.Bool("act.config.edit", false, "Open the config file in the editor ($VISUAL or $EDITOR), it's validated before saving")
+
+	SecretsSeal   = flag.Bool("act.secrets.seal", false, "Move plain text tokens of all profiles into the encrypted secrets store")
+	SecretsPasswd = flag.Bool("act.secrets.passwd", false, "Also seal the disk password (-passwd or KT_CLI_PASSWD) into the active profile")
+	SecretsHelper = flag.String("act.secrets.helper", "", "Set a shell command printing the secrets store passphrase for the active profile")
+
+	FilesList = flag.String("act.files", "", "List files in provided disk by ID or title (\".\" for default disk)")
+
+	Disks       = flag.Bool("act.disks", false, "List all user's disks")
+	DiskDefault = flag.String("act.disks.default", "", "Set default disk by ID or title and save it in config (\".\" to reset to the first disk)")
+
+	IsFolder = flag.Bool("act.folder", false, "Treat ID passed to -act.rename, -act.move and -act.delete as a folder ID")
+
+	Rename     = flag.String("act.rename", "", "Rename file by ID")
+	RenameName = flag.String("act.rename.name", "", "Set new name for rename")
+
+	Move       = flag.String("act.move", "", "Move file by ID")
+	MoveDisk   = flag.String("act.move.disk", "", "Set target disk for move (current disk if empty)")
+	MoveFolder = flag.String("act.move.folder", "", "Set target folder for move (root folder if empty)")
 
-	FilesList = flag.String("act.files", "", "List files in provided disk")
+	Copy       = flag.String("act.copy", "", "Copy file by ID")
+	CopyDisk   = flag.String("act.copy.disk", "", "Set target disk for copy (current disk if empty)")
+	CopyFolder = flag.String("act.copy.folder", "", "Set target folder for copy (root folder if empty)")
+
+	Delete = flag.String("act.delete", "", "Delete file by ID (asks for confirmation, see -yes)")
+
+	Mkdir        = flag.String("act.mkdir", "", "Create folder by slash-separated path (e.g. docs/reports)")
+	MkdirDisk    = flag.String("act.mkdir.disk", "", "Set disk for new folder (\".\" for default disk)")
+	MkdirParent  = flag.String("act.mkdir.parent", "", "Set parent folder ID the path is relative to (root folder if empty)")
+	MkdirParents = flag.Bool("act.mkdir.p", false, "Create missing parent folders and do not fail if the folder exists")
+
+	ShareCreate = flag.String("act.share.create", "", "Share file by ID and print its public link")
+	ShareRevoke = flag.String("act.share.revoke", "", "Revoke public link of the file by ID")
+	ShareList   = flag.String("act.share.list", "", "List all shared files in provided disk (\".\" for default disk)")
+	ShareQR     = flag.Bool("act.share.qr", false, "Also print the public link as QR code in terminal")
+
+	Find          = flag.String("act.find", "", "Search files in provided disk (\".\" for default disk)")
+	FindFolder    = flag.String("act.find.folder", "", "Set folder ID to search in (root folder if empty)")
+	FindName      = flag.String("act.find.name", "", "Filter by file name glob pattern, case-insensitive (e.g. *.pdf)")
+	FindRegex     = flag.String("act.find.regex", "", "Filter by file name regular expression")
+	FindMime      = flag.String("act.find.mime", "", "Filter by MIME type glob pattern (e.g. image/*)")
+	FindSize      = flag.String("act.find.size", "", "Filter by size: +N for bigger, -N for smaller, N for exact; K, M, G, T suffixes are supported. Several conditions are separated by comma (e.g. +1M,-1G)")
+	FindAfter     = flag.String("act.find.after", "", "Filter files created after the date (YYYY-MM-DD, RFC3339 or duration ago like 7d, 12h)")
+	FindBefore    = flag.String("act.find.before", "", "Filter files created before the date (same formats as -act.find.after)")
+	FindEncrypted = flag.String("act.find.encrypted", "", "Filter by encryption (true or false)")
+	FindShared    = flag.String("act.find.shared", "", "Filter by public link state (true or false)")
+
+	Stat         = flag.String("act.stat", "", "Show all metadata of the file by ID or by path from the disk root (e.g. /docs/report.pdf)")
+	StatDisk     = flag.String("act.stat.disk", "", "Set disk for file path (\".\" or empty for default disk)")
+	StatChecksum = flag.String("act.stat.checksum", "", "Also compute checksum of the file contents by streaming it (md5, sha1 or sha256)")
+
+	Get     = flag.String("act.get", "", "Download publicly shared file by its link or secret (no token required)")
+	GetPath = flag.String("act.get.path", ".", "Set path to save shared file (\"-\" for stdout)")
 	// @todo method to replace files contents
 )
 
-// ScanEnv scans environment variables as replacement for the flags that are not set
-func ScanEnv() {
-	if *Auth == "" {
-		*Auth = os.Getenv("KT_CLI_TOKEN")
-	}
-	if *Passwd == "" {
-		*Passwd = os.Getenv("KT_CLI_PASSWD")
-	}
+// IsTokenNotRequired checks if the requested action doesn't need the token to be asked before it is performed
+func IsTokenNotRequired() bool {
+	return *Get != "" || *Login || *LoginWeb || *Logout || *LogoutAll || *Agent || *AgentForget || *KeysImport != "" ||
+		*CryptEncrypt != "" || *CryptDecrypt != "" || IsConfigAction()
+}
+
+// IsSecretsRequired checks if the requested action needs the sealed secrets unlocked. Actions without a token
+// don't need them, except logging in and out that replace or revoke the sealed token
+func IsSecretsRequired() bool {
+	return !IsTokenNotRequired() || *Login || *LoginWeb || *Logout || *LogoutAll
+}
+
+// IsFlagSet checks if the flag was explicitly set in the command line. Values from environment variables
+// and config files are set with flag.Set too, so flag.Visit can't tell them apart
+func IsFlagSet(name string) bool {
+	return FlagOrigin(name) == originCommandLine
+}
+
+// IsConfigAction checks if the requested action only works with the config file
+func IsConfigAction() bool {
+	return *ConfigShow || *ConfigList || *ConfigGet != "" || *ConfigSet != "" || *ConfigUnset != "" || *ConfigEdit
 }
@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Settings are layered in the following order, from the lowest priority to the highest:
+//  1. default values of the flags
+//  2. system-wide config file (/etc/ktcloud/config.yaml, or %ProgramData%\ktcloud\config.yaml on Windows)
+//  3. active profile of the user config file (see ResolveConfigPath)
+//  4. project config file .ktcloud.yaml in the current directory or the nearest parent one
+//  5. KT_CLI_* environment variables, there is one for every flag (see EnvName)
+//  6. command line flags
+// System and project files have the same keys as a profile, but tokens and other secrets are never taken from them.
+// Security settings are not taken from them either, see dropUntrustedKeys.
+
+// projectConfigName is the name of the project config file
+const projectConfigName = ".ktcloud.yaml"
+
+// originDefault is the origin of flags that are not set by any layer
+const originDefault = "default"
+
+// originCommandLine is the origin of flags set in the command line
+const originCommandLine = "command line"
+
+// flagOrigins keeps the origin of every flag set by any layer
+var flagOrigins = make(map[string]string)
+
+// EnvName returns the name of the environment variable for the flag, e.g. KT_CLI_ACT_UPLOAD_DISK for act.upload.disk
+func EnvName(flagName string) string {
+	replacer := strings.NewReplacer(".", "_", "-", "_")
+	return "KT_CLI_" + strings.ToUpper(replacer.Replace(flagName))
+}
+
+// ScanEnv records the flags set in the command line and uses environment variables as replacement for the rest
+func ScanEnv() {
+	flag.Visit(func(f *flag.Flag) {
+		flagOrigins[f.Name] = originCommandLine
+	})
+
+	flag.VisitAll(func(f *flag.Flag) {
+		name := EnvName(f.Name)
+		if value := os.Getenv(name); value != "" {
+			setLayerFlag(f.Name, value, "environment variable "+name)
+		}
+	})
+}
+
+// FlagOrigin returns the description of the layer the flag value came from
+func FlagOrigin(name string) string {
+	if origin, ok := flagOrigins[name]; ok {
+		return origin
+	}
+
+	return originDefault
+}
+
+// setLayerFlag sets the flag value from the layer if it's not set by a layer with higher priority
+func setLayerFlag(name string, value string, origin string) {
+	if _, ok := flagOrigins[name]; ok {
+		return
+	}
+
+	if err := flag.Set(name, value); err != nil {
+		PrintError("Bad value of -%s from %s: %s", name, origin, err.Error())
+		return
+	}
+
+	flagOrigins[name] = origin
+}
+
+// ResolveConfigPath sets the path of the user config file if it is not set by -config flag or KT_CLI_CONFIG.
+// By default, it is ktcloud/config.yaml in the user config directory: $XDG_CONFIG_HOME or ~/.config on Linux,
+// ~/Library/Application Support on macOS and %AppData% on Windows
+func ResolveConfigPath() {
+	if *ConfigFilename != "" {
+		return
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		PrintError("Failed to find the user config directory, using the current one: %s", err.Error())
+		*ConfigFilename = "config.yaml"
+		return
+	}
+	*ConfigFilename = filepath.Join(dir, "ktcloud", "config.yaml")
+
+	// Older versions stored config.yaml in the current directory
+	if _, err = os.Stat("config.yaml"); err == nil {
+		PrintError("config.yaml in the current directory is not used anymore. "+
+			"Move it to %s or use -config=config.yaml", *ConfigFilename)
+	}
+}
+
+// systemConfigPath returns the path of the system-wide config file
+func systemConfigPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "ktcloud", "config.yaml")
+	}
+
+	return "/etc/ktcloud/config.yaml"
+}
+
+// findProjectConfig looks for the project config file in the current directory and its parents
+func findProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadLayerFile loads the settings from the system or project config file. It returns nil if there is no such file
+func loadLayerFile(path string) (*Profile, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{}
+	if err = yaml.Unmarshal(data, profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// ApplyLayers applies settings from config files to the flags that are not set by the environment or the command line.
+// It should be called after the profile is selected. Invalid values in config files and invalid security settings
+// are returned as errors, they are not replaced by defaults silently
+func ApplyLayers(config *Config) error {
+	type layer struct {
+		profile *Profile
+		origin  string
+		trusted bool
+	}
+
+	// Layers are listed from the highest priority, the first layer setting a flag wins
+	var layers []layer
+	if path := findProjectConfig(); path != "" {
+		profile, err := loadLayerFile(path)
+		if err != nil {
+			PrintError("Failed to load project config %s: %s", path, err.Error())
+		} else if profile != nil {
+			layers = append(layers, layer{profile, "project config " + path, false})
+		}
+	}
+
+	layers = append(layers, layer{&config.Profile,
+		fmt.Sprintf("user config %s (profile %s)", *ConfigFilename, config.ProfileName()), true})
+
+	profile, err := loadLayerFile(systemConfigPath())
+	if err != nil {
+		PrintError("Failed to load system config %s: %s", systemConfigPath(), err.Error())
+	} else if profile != nil {
+		layers = append(layers, layer{profile, "system config " + systemConfigPath(), false})
+	}
+
+	for _, l := range layers {
+		if !l.trusted {
+			dropUntrustedKeys(l.profile, l.origin)
+		}
+
+		// Files edited by hand are checked like -act.config.set does. Config actions still run, so they can fix the file
+		if err := validateProfile(l.profile); err != nil {
+			if !IsConfigAction() {
+				return fmt.Errorf("invalid %s: %w", l.origin, err)
+			}
+			PrintError("Invalid %s: %s", l.origin, err.Error())
+		}
+		applyProfileLayer(l.profile, l.origin)
+	}
+
+	pkg.SetEndpoint(*Endpoint)
+	pkg.SetRetryPolicy(*Retries, *RetryDelay)
+	pkg.SetNameEncryption(*EncryptNames)
+	if *NoAgent {
+		pkg.SetAgentSocket("")
+	} else if *AgentSocket != "" {
+		pkg.SetAgentSocket(*AgentSocket)
+	}
+	SetPrintMode(*PrintModeFlag)
+
+	policy, err := pkg.ParseSignaturePolicy(*Signatures)
+	if err != nil {
+		return fmt.Errorf("-signatures from %s: %w", FlagOrigin("signatures"), err)
+	}
+	pkg.SetSignaturePolicy(policy)
+
+	return nil
+}
+
+// dropUntrustedKeys clears security settings of the system or project config file and warns about each of them.
+// A project file is found in any parent directory, e.g. in a cloned repository, so it could send the token
+// to another server, replace the disk keys or turn off name encryption. The secret helper is never taken from layers,
+// it's cleared for the warning
+func dropUntrustedKeys(profile *Profile, origin string) {
+	keys := []struct {
+		name  string
+		value *string
+	}{
+		{"endpoint", &profile.Endpoint},
+		{"public_key_file", &profile.PublicKeyFile},
+		{"private_key_file", &profile.PrivateKeyFile},
+		{"signatures", &profile.Signatures},
+		{"secret_helper", &profile.SecretHelper},
+	}
+
+	for _, key := range keys {
+		if *key.value != "" {
+			PrintError("%s is ignored in %s, set it in the user config, environment or command line", key.name, origin)
+			*key.value = ""
+		}
+	}
+
+	// These files can only turn name encryption on, turning it off would upload names as plain text
+	if profile.EncryptNames != nil && !*profile.EncryptNames {
+		PrintError("encrypt_names=false is ignored in %s, set it in the user config, environment or command line", origin)
+		profile.EncryptNames = nil
+	}
+}
+
+// applyProfileLayer sets flags from the settings of the profile
+func applyProfileLayer(profile *Profile, origin string) {
+	if profile.Endpoint != "" {
+		setLayerFlag("endpoint", profile.Endpoint, origin)
+	}
+	if profile.DefaultDisk != "" {
+		setLayerFlag("disk", profile.DefaultDisk, origin)
+	}
+	if profile.DefaultFolder != "" {
+		setLayerFlag("folder", profile.DefaultFolder, origin)
+	}
+	if profile.PublicKeyFile != "" {
+		setLayerFlag("public", profile.PublicKeyFile, origin)
+	}
+	if profile.PrivateKeyFile != "" {
+		setLayerFlag("private", profile.PrivateKeyFile, origin)
+	}
+	if profile.Output != nil {
+		setLayerFlag("output", strconv.Itoa(*profile.Output), origin)
+	}
+	if profile.Pretty != nil {
+		setLayerFlag("pretty", strconv.FormatBool(*profile.Pretty), origin)
+	}
+	if profile.Concurrency != nil {
+		setLayerFlag("concurrency", strconv.Itoa(*profile.Concurrency), origin)
+	}
+	if profile.Retries != nil {
+		setLayerFlag("retries", strconv.Itoa(*profile.Retries), origin)
+	}
+	if profile.RetryDelay != "" {
+		setLayerFlag("retry-delay", profile.RetryDelay, origin)
+	}
+	if profile.EncryptNames != nil {
+		setLayerFlag("encrypt-names", strconv.FormatBool(*profile.EncryptNames), origin)
+	}
+	if profile.Signatures != "" {
+		setLayerFlag("signatures", profile.Signatures, origin)
+	}
+}
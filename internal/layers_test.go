@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyLayersUntrustedEncryptNames(t *testing.T) {
+	enabled, disabled := true, false
+
+	tests := []struct {
+		name       string
+		user       *bool
+		project    string
+		want       bool
+		wantOrigin string
+	}{
+		{"project can't turn it off", &enabled, "encrypt_names: false\n", true, "user config"},
+		{"project can't turn it off by default", nil, "encrypt_names: false\n", false, originDefault},
+		{"project can turn it on", &disabled, "encrypt_names: true\n", true, "project config"},
+		{"project without the key", &enabled, "pretty: true\n", true, "user config"},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(wd)
+		flagOrigins = make(map[string]string)
+		*EncryptNames, *Pretty, *Endpoint = false, false, ""
+		*ConfigFilename = ""
+	}()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, projectConfigName), []byte(test.project+"endpoint: http://evil.example\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chdir(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			flagOrigins = make(map[string]string)
+			*EncryptNames, *Pretty, *Endpoint = false, false, ""
+			*ConfigFilename = filepath.Join(dir, "config.yaml")
+
+			config := CreateDefaultConfig()
+			config.EncryptNames = test.user
+			if err := ApplyLayers(config); err != nil {
+				t.Fatal(err)
+			}
+
+			if *EncryptNames != test.want {
+				t.Errorf("encrypt-names = %t, want %t", *EncryptNames, test.want)
+			}
+			if origin := FlagOrigin("encrypt-names"); !strings.HasPrefix(origin, test.wantOrigin) {
+				t.Errorf("encrypt-names origin = %q, want %q", origin, test.wantOrigin)
+			}
+			if *Endpoint != "" {
+				t.Errorf("endpoint = %q is taken from the project config", *Endpoint)
+			}
+		})
+	}
+}
+
+func TestApplyLayersInvalidValue(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(wd)
+		flagOrigins = make(map[string]string)
+		*Retries = 0
+		*ConfigFilename = ""
+	}()
+
+	dir := t.TempDir()
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	flagOrigins = make(map[string]string)
+	*ConfigFilename = filepath.Join(dir, "config.yaml")
+
+	retries := 99
+	config := CreateDefaultConfig()
+	config.Retries = &retries
+
+	err = ApplyLayers(config)
+	if err == nil || !strings.Contains(err.Error(), "retries") {
+		t.Fatalf("error = %v, want invalid retries", err)
+	}
+	if *Retries != 0 {
+		t.Errorf("retries = %d is applied", *Retries)
+	}
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"errors"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"sync"
+)
+
+// errNameKeyUnavailable is returned for files of disks which private key couldn't be unlocked before
+var errNameKeyUnavailable = errors.New("private key is not available")
+
+// SetupNameDecryption makes the library show real names of files with encrypted names.
+// The private key of each disk is unlocked on the first file with an encrypted name, so listings of disks
+// without such files don't need the password. If the key can't be unlocked, placeholders are shown
+func SetupNameDecryption(config *Config) {
+	var mutex sync.Mutex
+	keyRings := make(map[string]*crypto.KeyRing)
+
+	pkg.SetNameDecryptor(func(file *pkg.File) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		keyRing, ok := keyRings[file.Disk]
+		if !ok {
+			var err error
+			keyRing, err = nameKeyRing(config, file.Disk)
+			keyRings[file.Disk] = keyRing
+			if err != nil {
+				PrintError("Names of encrypted files are not shown, provide the password to see them: %s", err.Error())
+				return "", err
+			}
+		}
+		if keyRing == nil {
+			return "", errNameKeyUnavailable
+		}
+
+		return pkg.DecryptFileName(keyRing, file.NameCrypto)
+	})
+}
+
+// nameKeyRing unlocks the private key of the disk to decrypt names of its files
+func nameKeyRing(config *Config, disk string) (*crypto.KeyRing, error) {
+	cryptoInfo := NewDefaultCryptoInfo()
+	if err := cryptoInfo.TryGetReady(config.Token, disk); err != nil {
+		return nil, err
+	}
+
+	return pkg.GetPrivateKeyRing(cryptoInfo.RawCryptoKey, []byte(cryptoInfo.Password))
+}
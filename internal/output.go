@@ -1,10 +1,15 @@
 package internal
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/kt-soft-dev/kt-cli/pkg"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -14,11 +19,47 @@ const (
 	ModePlain
 	// ModeNoNewline is printing like plain but without a newline
 	ModeNoNewline
+	// ModeJson is printing data as JSON to stdout (see PrintJson), messages are printed like plain to stderr
+	ModeJson
 )
 
+// modeNames are the names -output accepts besides the mode numbers
+var modeNames = map[string]int{"log": ModeLog, "plain": ModePlain, "nonewline": ModeNoNewline, "json": ModeJson}
+
+// printModeValue is the value of -output flag. It is the mode number, the name of the mode is accepted too
+type printModeValue int
+
+func (v *printModeValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+func (v *printModeValue) Set(value string) error {
+	mode, ok := modeNames[strings.ToLower(strings.TrimSpace(value))]
+	if !ok {
+		var err error
+		mode, err = strconv.Atoi(value)
+		if err != nil || mode < ModeLog || mode > ModeJson {
+			return fmt.Errorf("unknown output mode %q", value)
+		}
+	}
+
+	*v = printModeValue(mode)
+	return nil
+}
+
+// printModeFlag defines the flag of the print mode, see printModeValue
+func printModeFlag(name string, value int, usage string) *int {
+	mode := value
+	flag.Var((*printModeValue)(&mode), name, usage)
+	return &mode
+}
+
 // printMode is the singleton represents current way of printing messages
 var printMode = ModeLog
 
+// printOutput is where Print writes messages in plain modes. Log mode always writes to stderr
+var printOutput io.Writer = os.Stdout
+
 // SetPrintMode sets the way of printing messages. See constants like Mode* for available modes
 // This mode is ignored in some cases in interactive mode
 func SetPrintMode(mode int) {
@@ -26,15 +67,23 @@ func SetPrintMode(mode int) {
 	pkg.SetLogger(Print)
 }
 
+// SetPrintOutput sets where Print writes messages in plain modes.
+// It is used to keep stdout clean when it is used for data, like file contents
+func SetPrintOutput(writer io.Writer) {
+	printOutput = writer
+}
+
 // Print prints the content with optional parameters in the way defined by printMode
 func Print(content string, params ...interface{}) {
 	text := fmt.Sprintf(content, params...)
 
 	switch printMode {
 	case ModePlain:
-		fmt.Println(text)
+		_, _ = fmt.Fprintln(printOutput, text)
+	case ModeJson:
+		_, _ = fmt.Fprintln(os.Stderr, text)
 	case ModeNoNewline:
-		fmt.Print(text)
+		_, _ = fmt.Fprint(printOutput, text)
 	default:
 		log.Println(text)
 	}
@@ -49,7 +98,7 @@ func PrintError(err string, params ...interface{}) {
 	text := fmt.Sprintf(err, params...)
 
 	switch printMode {
-	case ModePlain:
+	case ModePlain, ModeJson:
 		_, _ = fmt.Fprintln(os.Stderr, text)
 	case ModeNoNewline:
 		_, _ = fmt.Fprint(os.Stderr, text)
@@ -57,3 +106,25 @@ func PrintError(err string, params ...interface{}) {
 		errorLogger.Println(text)
 	}
 }
+
+// IsJsonMode checks if data should be printed as JSON by PrintJson instead of tables and lines
+func IsJsonMode() bool {
+	return printMode == ModeJson
+}
+
+// PrintJson prints the data as JSON to stdout, it is pretty-printed with -pretty flag
+func PrintJson(data interface{}) {
+	var jsonData []byte
+	var err error
+	if *Pretty {
+		jsonData, err = json.MarshalIndent(data, "", "    ")
+	} else {
+		jsonData, err = json.Marshal(data)
+	}
+	if err != nil {
+		PrintError("Failed to convert to JSON: %s", err.Error())
+		return
+	}
+
+	_, _ = fmt.Fprintln(os.Stdout, string(jsonData))
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"sync"
+)
+
+// Public keys of disks are pinned on first use: the fingerprint of the key received from the server is saved
+// in the profile, and later the key is used only if its fingerprint is the same.
+// A changed key is refused until it's accepted by -act.keys.trust, so a substituted key is never used silently
+
+// pinningMutex protects KnownKeys of the profile, keys can be checked by parallel uploads
+var pinningMutex sync.Mutex
+
+// SetupKeyPinning makes the library check disk public keys against the fingerprints pinned in the active profile
+func SetupKeyPinning(config *Config) {
+	pkg.SetKeyVerifier(func(disk *pkg.Disk, fingerprint string) error {
+		pinningMutex.Lock()
+		defer pinningMutex.Unlock()
+
+		pinned, ok := config.KnownKeys[disk.ID]
+		if !ok {
+			if config.KnownKeys == nil {
+				config.KnownKeys = make(map[string]string)
+			}
+			config.KnownKeys[disk.ID] = fingerprint
+			Print("Public key of disk %s (%s) is trusted on first use, fingerprint %s", disk.Title, disk.ID, fingerprint)
+			return nil
+		}
+
+		if pinned != fingerprint {
+			err := &pkg.KeyChangedError{DiskID: disk.ID, Pinned: pinned, Fingerprint: fingerprint}
+			printKeyChangedAlert(disk, err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// printKeyChangedAlert prints the warning about the changed public key of the disk
+func printKeyChangedAlert(disk *pkg.Disk, err *pkg.KeyChangedError) {
+	PrintError("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
+	PrintError("@    WARNING: DISK PUBLIC KEY HAS CHANGED!                @")
+	PrintError("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
+	PrintError("The server sent a different public key for disk %s (%s).", disk.Title, disk.ID)
+	PrintError("Somebody may be trying to make you encrypt files to their key.")
+	PrintError("It is also possible that the disk keys have been rotated.")
+	PrintError("Pinned fingerprint:   %s", err.Pinned)
+	PrintError("Received fingerprint: %s", err.Fingerprint)
+	PrintError("Nothing will be encrypted or verified with this key. If the change is expected, accept it with:")
+	PrintError("  ktcloud -act.keys.trust=%s", disk.ID)
+}
@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Key rotation replaces the disk keys and then re-encrypts existing files with the new public key.
+// The API can't replace file contents, so each file is downloaded and decrypted with the old key, uploaded again
+// into the same folder and the old copy is deleted. Re-encrypted files get new IDs, the old and new IDs are appended
+// to the log file next to the config. Re-encryption runs in the foreground only, there is no background mode: the
+// command blocks until every file is done. The progress is saved in a state file, so interrupted re-encryption
+// continues from the same file when -act.keys.rotate is run again
+
+// rotationState is the saved progress of the key rotation of a disk
+type rotationState struct {
+	Endpoint string    `yaml:"endpoint"`
+	DiskID   string    `yaml:"disk_id"`
+	Started  time.Time `yaml:"started"`
+	// OldPublicKey and OldCryptoKey are the replaced keys, the crypto key is still encrypted with the disk password
+	OldPublicKey string `yaml:"old_public_key"`
+	OldCryptoKey string `yaml:"old_crypto_key"`
+	// Files are IDs of files left to re-encrypt, the first one is in progress
+	Files []string `yaml:"files"`
+	// Uploaded is the ID of the re-encrypted copy of the first file if it's uploaded, but the old one isn't deleted yet
+	Uploaded string `yaml:"uploaded,omitempty"`
+}
+
+// rotationStatePath returns the path of the rotation state file of the disk
+func rotationStatePath(diskId string) string {
+	return filepath.Join(filepath.Dir(*ConfigFilename), "rotation-"+filepath.Base(diskId)+".yaml")
+}
+
+// rotationLogPath returns the path of the file with old and new IDs of re-encrypted files of the disk
+func rotationLogPath(diskId string) string {
+	return filepath.Join(filepath.Dir(*ConfigFilename), "rotation-"+filepath.Base(diskId)+"-ids.txt")
+}
+
+// appendRotationLog appends the line to the ID log of the disk. The log is kept after the rotation is finished
+func appendRotationLog(diskId string, line string) error {
+	path := rotationLogPath(diskId)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(line + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// loadRotationState returns the unfinished rotation of the disk or nil if there is none
+func loadRotationState(diskId string) (*rotationState, error) {
+	data, err := os.ReadFile(rotationStatePath(diskId))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := &rotationState{}
+	if err = yaml.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("bad rotation state file: %w", err)
+	}
+	if state.DiskID != diskId || state.Endpoint != *Endpoint {
+		return nil, errors.New("rotation state file belongs to another disk or server")
+	}
+
+	return state, nil
+}
+
+// save writes the state file. It contains the old key, so it's readable only by the owner
+func (s *rotationState) save() error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	path := rotationStatePath(s.DiskID)
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// remove deletes the state file when the rotation is finished
+func (s *rotationState) remove() {
+	if err := os.Remove(rotationStatePath(s.DiskID)); err != nil && !os.IsNotExist(err) {
+		PrintError("Failed to delete rotation state file: %s", err.Error())
+	}
+}
+
+// reencryptFiles re-encrypts files left in the state with the new key of the disk. The progress is saved after
+// every file, and the state file is removed when all files are done
+func reencryptFiles(config *Config, state *rotationState, password string) error {
+	oldKey, err := helper.DecryptMessageWithPassword([]byte(password), state.OldCryptoKey)
+	if err != nil {
+		return errors.New("wrong password of the old key")
+	}
+	oldInfo := &pkg.CryptoInfo{
+		EncryptedCryptoKey: state.OldCryptoKey,
+		RawCryptoKey:       oldKey,
+		PublicKey:          state.OldPublicKey,
+		Password:           password,
+	}
+
+	newInfo := &pkg.CryptoInfo{Password: password}
+	if err = newInfo.TryGetReady(config.Token, state.DiskID); err != nil {
+		return fmt.Errorf("failed to get the new key: %w", err)
+	}
+
+	// The name encryption setting is restored after files with encrypted names are uploaded
+	defer pkg.SetNameEncryption(*EncryptNames)
+
+	// Errors tell how many files are left and where the progress is, so the user knows what rerunning will do
+	total := len(state.Files)
+	stopped := func(err error) error {
+		return fmt.Errorf("%w. %d of %d files are left to re-encrypt, the progress is saved in %s",
+			err, len(state.Files), total, rotationStatePath(state.DiskID))
+	}
+
+	for done := 1; len(state.Files) > 0; done++ {
+		fileId := state.Files[0]
+		file, err := reencryptFile(config, state, oldInfo, newInfo)
+		if err != nil {
+			return stopped(fmt.Errorf("failed to re-encrypt file %s: %w", fileId, err))
+		}
+
+		// The old file may be deleted by the interrupted run, its copy is logged then
+		if state.Uploaded != "" {
+			line := fileId + " " + state.Uploaded
+			if file != nil {
+				line += " " + file.Name
+			}
+			if err = appendRotationLog(state.DiskID, line); err != nil {
+				return stopped(fmt.Errorf("failed to write ID log: %w", err))
+			}
+		}
+
+		state.Files = state.Files[1:]
+		state.Uploaded = ""
+		if err = state.save(); err != nil {
+			return stopped(fmt.Errorf("failed to save rotation state: %w", err))
+		}
+
+		switch {
+		case file == nil:
+			Print("[%d/%d] File %s doesn't exist anymore, skipped", done, total, fileId)
+		case file.URLShared:
+			Print("[%d/%d] File %s is re-encrypted, its public link stopped working", done, total, file.Name)
+		default:
+			Print("[%d/%d] File %s is re-encrypted", done, total, file.Name)
+		}
+	}
+
+	state.remove()
+	return nil
+}
+
+// reencryptFile re-encrypts the first file of the state and returns it with the decrypted name. Deleted files are
+// skipped with nil. The copy is uploaded before the old file is deleted, so an interruption never loses a file
+func reencryptFile(config *Config, state *rotationState, oldInfo *pkg.CryptoInfo, newInfo *pkg.CryptoInfo) (*pkg.File, error) {
+	fileId := state.Files[0]
+	file, err := pkg.GetFileById(config.Token, fileId)
+	if errors.Is(err, pkg.ErrFileNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if file.NameCrypto != "" {
+		if file.Name, err = oldInfo.DecryptName(file.NameCrypto); err != nil {
+			return nil, fmt.Errorf("failed to decrypt file name: %w", err)
+		}
+	}
+
+	if state.Uploaded == "" {
+		// Files are kept in memory the same way as by downloads and uploads
+		content := &bytes.Buffer{}
+		if _, _, err = pkg.DownloadFile(config.Token, fileId, content, oldInfo); err != nil {
+			return nil, err
+		}
+
+		// The copy may be uploaded by the run interrupted before it saved the state
+		state.Uploaded, err = findReencryptedCopy(config, state, file, content.Bytes(), newInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		if state.Uploaded == "" {
+			pkg.SetNameEncryption(file.NameCrypto != "" || *EncryptNames)
+			state.Uploaded, err = pkg.UploadFile(config.Token, file.Name, "", file.Disk, file.Folder, newInfo, content)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err = state.save(); err != nil {
+			return nil, fmt.Errorf("failed to save rotation state: %w", err)
+		}
+	}
+
+	if err = pkg.DeleteFile(config.Token, fileId); err != nil {
+		return nil, fmt.Errorf("re-encrypted copy %s is uploaded, but the old file is not deleted: %w", state.Uploaded, err)
+	}
+
+	return file, nil
+}
+
+// findReencryptedCopy returns the ID of the file with the same name in the same folder, uploaded since the rotation
+// started, which is decrypted with the new key into the same content. It returns the empty ID if there is none
+func findReencryptedCopy(config *Config, state *rotationState, file *pkg.File, content []byte, newInfo *pkg.CryptoInfo) (string, error) {
+	files, _, err := pkg.GetAllFiles(config.Token, file.Disk, file.Folder)
+	if err != nil {
+		return "", fmt.Errorf("failed to look for a copy uploaded before: %w", err)
+	}
+
+	pending := make(map[string]bool, len(state.Files))
+	for _, id := range state.Files {
+		pending[id] = true
+	}
+
+	for _, candidate := range files {
+		if pending[candidate.ID] || !candidate.Encrypted || int64(candidate.Date) < state.Started.Unix() {
+			continue
+		}
+
+		name := candidate.Name
+		if candidate.NameCrypto != "" {
+			if name, err = newInfo.DecryptName(candidate.NameCrypto); err != nil {
+				continue
+			}
+		}
+		if name != file.Name {
+			continue
+		}
+
+		copyContent := &bytes.Buffer{}
+		if _, _, err = pkg.DownloadFile(config.Token, candidate.ID, copyContent, newInfo); err != nil {
+			continue
+		}
+		if bytes.Equal(copyContent.Bytes(), content) {
+			Print("Copy %s of file %s is already uploaded", candidate.ID, file.Name)
+			return candidate.ID, nil
+		}
+	}
+
+	return "", nil
+}
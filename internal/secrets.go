@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+	"gopkg.in/yaml.v2"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Secrets of the profile are sealed with a passphrase into Profile.Sealed field instead of being stored as plain text.
+// The passphrase is taken from KT_CLI_STORE_PASSPHRASE environment variable,
+// from the output of the profile's secret helper command (like "pass show ktcloud"), or asked interactively.
+
+// sealedSecrets is the content of Profile.Sealed after unsealing
+type sealedSecrets struct {
+	Token  string `yaml:"token"`
+	Passwd string `yaml:"passwd,omitempty"`
+}
+
+// sealSecrets encrypts the secrets with the passphrase. The key is derived from the passphrase by OpenPGP S2K
+func sealSecrets(secrets *sealedSecrets, passphrase []byte) (string, error) {
+	data, err := yaml.Marshal(secrets)
+	if err != nil {
+		return "", err
+	}
+
+	return helper.EncryptMessageWithPassword(passphrase, string(data))
+}
+
+// unsealSecrets decrypts the secrets sealed by sealSecrets
+func unsealSecrets(sealed string, passphrase []byte) (*sealedSecrets, error) {
+	data, err := helper.DecryptMessageWithPassword(passphrase, sealed)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or damaged secrets")
+	}
+
+	secrets := &sealedSecrets{}
+	err = yaml.Unmarshal([]byte(data), secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+// storePassphrase returns the passphrase of the secrets store for the profile.
+// If confirm is true, the interactively entered passphrase is asked twice, it's used when sealing for the first time
+func storePassphrase(profile *Profile, confirm bool) ([]byte, error) {
+	if passphrase := os.Getenv("KT_CLI_STORE_PASSPHRASE"); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	if profile.SecretHelper != "" {
+		return runSecretHelper(profile.SecretHelper)
+	}
+
+	if *NotInteractive {
+		return nil, errors.New("passphrase is required, set KT_CLI_STORE_PASSPHRASE or a secret helper")
+	}
+
+	passphrase, err := ReadSecret("Secrets store passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, errors.New("passphrase is empty")
+	}
+
+	if confirm {
+		repeated, err := ReadSecret("Repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if repeated != passphrase {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	return []byte(passphrase), nil
+}
+
+// runSecretHelper runs the helper command with the system shell and returns the first line of its output
+func runSecretHelper(command string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("secret helper failed: %w", err)
+	}
+
+	passphrase, _, _ := bytes.Cut(output, []byte("\n"))
+	passphrase = bytes.TrimSpace(passphrase)
+	if len(passphrase) == 0 {
+		return nil, errors.New("secret helper returned empty passphrase")
+	}
+
+	return passphrase, nil
+}
+
+// UnlockSecrets unseals the secrets of the active profile if they are sealed.
+// The token is put into the profile, and the stored password is used if -passwd is not set
+func (c *Config) UnlockSecrets() error {
+	if c.Sealed == "" {
+		return nil
+	}
+
+	passphrase, err := c.passphrases.get(&c.Profile, false)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := unsealSecrets(c.Sealed, passphrase)
+	if err != nil {
+		return err
+	}
+
+	c.passphrase = passphrase
+	c.unsealed = *secrets
+	c.sealedPasswd = secrets.Passwd
+	if c.Token == "" {
+		c.Token = secrets.Token
+	}
+	if *Passwd == "" {
+		*Passwd = secrets.Passwd
+	}
+
+	return nil
+}
+
+// sealActive seals the secrets of the active profile with the passphrase it was unlocked or sealed with.
+// It is called before saving, so the token changed during the execution is not written as plain text
+func (c *Config) sealActive(profile *Profile) error {
+	if c.passphrase == nil {
+		if c.Sealed != "" {
+			// The store wasn't unlocked, so the token can't be changed. Keep the sealed value as is
+			profile.Token = ""
+		}
+		return nil
+	}
+
+	secrets := sealedSecrets{Token: c.Token, Passwd: c.sealedPasswd}
+	if profile.Sealed != "" && secrets == c.unsealed {
+		// Sealing produces a different value every time, so unchanged secrets are kept as is
+		profile.Token = ""
+		return nil
+	}
+
+	sealed, err := sealSecrets(&secrets, c.passphrase)
+	if err != nil {
+		return err
+	}
+
+	profile.Sealed = sealed
+	profile.Token = ""
+	return nil
+}
+
+// SealAll moves plain text tokens of all profiles into the secrets store. Each profile is sealed with its own
+// passphrase, so a profile with a secret helper can be unsealed by it later.
+// If withPasswd is true, the disk password is sealed into the active profile too
+func (c *Config) SealAll(withPasswd bool) (int, error) {
+	passphrase, err := c.passphrases.get(&c.Profile, true)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, profile := range c.inactiveProfiles() {
+		if profile.Token == "" {
+			continue
+		}
+
+		profilePassphrase, err := c.passphrases.get(profile, true)
+		if err != nil {
+			return count, err
+		}
+
+		profile.Sealed, err = sealSecrets(&sealedSecrets{Token: profile.Token}, profilePassphrase)
+		if err != nil {
+			return count, err
+		}
+		profile.Token = ""
+		count++
+	}
+
+	// The active profile keeps the token in memory, it's sealed on saving
+	if c.Token != "" {
+		count++
+	}
+	c.passphrase = passphrase
+	c.unsealed = sealedSecrets{}
+	if withPasswd {
+		c.sealedPasswd = *Passwd
+	}
+
+	return count, nil
+}
+
+// unsealProfile returns the token of the inactive profile, unsealing it with the passphrase of that profile if needed
+func (c *Config) unsealProfile(profile *Profile) (string, error) {
+	if profile.Sealed == "" {
+		return profile.Token, nil
+	}
+
+	passphrase, err := c.passphrases.get(profile, false)
+	if err != nil {
+		return "", err
+	}
+
+	secrets, err := unsealSecrets(profile.Sealed, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	return secrets.Token, nil
+}
+
+// passphraseCache keeps passphrases by their source, so every secret helper is run and the passphrase
+// is asked only once when several profiles are sealed or unsealed. The empty source is the environment variable
+// or the interactive prompt
+type passphraseCache map[string][]byte
+
+// get returns the passphrase of the profile from the cache or from storePassphrase
+func (p *passphraseCache) get(profile *Profile, confirm bool) ([]byte, error) {
+	source := profile.SecretHelper
+	if os.Getenv("KT_CLI_STORE_PASSPHRASE") != "" {
+		source = ""
+	}
+	if passphrase, ok := (*p)[source]; ok {
+		return passphrase, nil
+	}
+
+	passphrase, err := storePassphrase(profile, confirm)
+	if err != nil {
+		return nil, err
+	}
+
+	if *p == nil {
+		*p = make(passphraseCache)
+	}
+	(*p)[source] = passphrase
+	return passphrase, nil
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// uploadDirectory uploads the local directory with all nested files into a folder with the same name.
+// The total size is checked against the available space before anything is sent
+func uploadDirectory(config *Config, root string) {
+	var files []string
+	var totalSize int64
+
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, filePath)
+		totalSize += info.Size()
+		return nil
+	})
+	if err != nil {
+		PrintError("Failed to read directory: %s", err.Error())
+		return
+	}
+	if len(files) == 0 {
+		PrintError("Directory is empty")
+		return
+	}
+
+	if err = CheckSpaceFor(config, totalSize); err != nil {
+		PrintError(err.Error())
+		return
+	}
+
+	rootName := filepath.Base(filepath.Clean(root))
+	Print("Uploading %d files (%s) into folder %s", len(files), ByteCount(totalSize), rootName)
+
+	// Folders are created first, so files can be uploaded in parallel without racing for the same folder
+	folders := make(map[string]string)
+	folderIds := make([]string, len(files))
+	for i, filePath := range files {
+		relative, err := filepath.Rel(root, filePath)
+		if err != nil {
+			PrintError(err.Error())
+			return
+		}
+
+		folderPath := path.Join(rootName, filepath.ToSlash(filepath.Dir(relative)))
+		folderId, ok := folders[folderPath]
+		if !ok {
+			folder, err := pkg.MakeFolderPath(config.Token, *UploadDisk, *UploadFolder, folderPath, true)
+			if err != nil {
+				PrintError("Failed to create folder %s: %s", folderPath, err.Error())
+				return
+			}
+
+			folderId = folder.ID
+			folders[folderPath] = folderId
+		}
+		folderIds[i] = folderId
+	}
+
+	// The public key is prepared once here, otherwise parallel uploads would fetch it at the same time
+	cryptoInfo := NewDefaultCryptoInfo()
+	if err = cryptoInfo.TryGetPublicKey(config.Token, *UploadDisk); err != nil {
+		PrintError("Failed to prepare the key for encryption: %s", err.Error())
+		return
+	}
+
+	// The signing key is prepared once too, with the password or from the key agent. If it fails, the password
+	// is dropped, and the signature policy decides whether files are uploaded unsigned
+	if cryptoInfo.Password != "" || pkg.IsAgentRunning() {
+		if err = cryptoInfo.TryGetReady(config.Token, *UploadDisk); err != nil {
+			PrintError("Failed to get the private key for signing: %s", err.Error())
+			cryptoInfo.Password = ""
+		}
+	}
+
+	workers := *Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Upload stops after the first failure, files already being uploaded are finished
+	var failed atomic.Bool
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := uploadDirFile(config, files[i], folderIds[i], cryptoInfo); err != nil {
+					PrintError(err.Error())
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+
+	for i := range files {
+		if failed.Load() {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if !failed.Load() {
+		Print("Directory %s uploaded", root)
+	}
+}
+
+// uploadDirFile uploads one file of the directory into the folder
+func uploadDirFile(config *Config, filePath string, folderId string, cryptoInfo *pkg.CryptoInfo) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s", filePath)
+	}
+	defer file.Close()
+
+	_, err = pkg.UploadFile(config.Token, filepath.Base(filePath), "", *UploadDisk, folderId, cryptoInfo, file)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", filePath, err)
+	}
+
+	return nil
+}
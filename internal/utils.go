@@ -2,11 +2,14 @@ package internal
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
 	"github.com/kt-soft-dev/kt-cli/pkg"
+	"golang.org/x/crypto/ssh/terminal"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -67,8 +70,8 @@ func GetActualError(response *pkg.ApiResponse, err error) error {
 	if err != nil {
 		return err
 	}
-	if response != nil && response.Error.Code != 0 {
-		return errors.New(response.Error.Message)
+	if response != nil {
+		return response.Err()
 	}
 
 	return nil
@@ -78,7 +81,7 @@ func GetActualError(response *pkg.ApiResponse, err error) error {
 func IsStdin() bool {
 	fi, err := os.Stdin.Stat()
 	if err != nil {
-		PrintError("os.Stdin.Stat()", err)
+		PrintError("os.Stdin.Stat(): %v", err)
 		return false
 	}
 
@@ -100,14 +103,18 @@ func ByteCount(b int64) string {
 		float64(b)/float64(div), "KMGTPE"[exp])
 }
 
-// DiskIdOrDefault returns the disk id if it is not empty, otherwise it returns the default disk id
+// DiskIdOrDefault returns the id of the disk provided by id or title.
+// If the disk is empty or ".", it returns the default disk (-disk flag or its layers) or the first user's disk.
 // It is useful for most users, they usually have only one disk
 func DiskIdOrDefault(config *Config, diskId string) (string, *pkg.Disk, error) {
 	if diskId == "." {
 		diskId = ""
 	}
+	if diskId == "" {
+		diskId = *DiskFlag
+	}
 
-	disk, _, err := pkg.GetUserDisk(config.Token, "")
+	disk, _, err := pkg.GetUserDisk(config.Token, diskId)
 	if err != nil {
 		return diskId, nil, err
 	}
@@ -128,8 +135,101 @@ func NewDefaultCryptoInfo() *pkg.CryptoInfo {
 	b, err = os.ReadFile(*PrivateKeyFile)
 	if err == nil {
 		Print("Using private key from file %s", *PrivateKeyFile)
-		info.EncryptedCryptoKey = string(b)
+		info.RawCryptoKey, info.EncryptedCryptoKey = privateKeyFromFile(string(b), info.Password)
 	}
 
 	return info
 }
+
+// privateKeyFromFile returns the raw or the encrypted crypto key from the private key file.
+// Files exported by -act.keys contain the private key itself: it's already decrypted from the server's crypto key,
+// but still locked with the password. Such a key is used as the raw key, so files can be decrypted without
+// requesting the key from the server, e.g. files shared by link. The file used to be read as the server's crypto key,
+// so a copy of it (a message encrypted with the password) is still accepted: it's decrypted if the password is known
+func privateKeyFromFile(key string, password string) (raw string, encrypted string) {
+	if !strings.Contains(key, "-----BEGIN PGP MESSAGE") {
+		return key, ""
+	}
+	if password == "" {
+		return "", key
+	}
+
+	raw, err := helper.DecryptMessageWithPassword([]byte(password), key)
+	if err != nil {
+		PrintError("Failed to decrypt private key file %s: %s", *PrivateKeyFile, err.Error())
+		return "", key
+	}
+
+	return raw, key
+}
+
+// Confirm asks the user to confirm the action and returns true if the answer is "y".
+// The question is not asked if -yes flag is set. In non-interactive mode the action is never confirmed without -yes
+func Confirm(prompt string) bool {
+	if *AssumeYes {
+		return true
+	}
+
+	answer := pkg.ScanOrDefault(prompt+" (y/n): ", "n")
+	return strings.ToLower(strings.TrimSpace(answer)) == "y"
+}
+
+// ParseSize parses human-readable size like "100M" or "1.5GiB" to bytes. Units are 1024-based
+func ParseSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := int64(1)
+	if value != "" {
+		if exp := strings.IndexByte("KMGTPE", value[len(value)-1]); exp >= 0 {
+			for i := 0; i <= exp; i++ {
+				multiplier *= 1024
+			}
+			value = value[:len(value)-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("bad size %q", size)
+	}
+
+	return int64(number * float64(multiplier)), nil
+}
+
+// ParseTime parses the date in YYYY-MM-DD or RFC3339 format.
+// Also it accepts durations like "7d" or "12h" meaning the time ago from now
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	if days, found := strings.CutSuffix(value, "d"); found {
+		number, err := strconv.Atoi(days)
+		if err == nil {
+			return time.Now().AddDate(0, 0, -number), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	return time.Time{}, fmt.Errorf("bad date %q", value)
+}
+
+// ReadSecret asks for the secret like a password or a token without displaying the typed characters
+func ReadSecret(prompt string) (string, error) {
+	fmt.Print(prompt)
+	secret, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(secret)), nil
+}
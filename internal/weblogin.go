@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// webLoginTimeout is how long the CLI waits for the user to authorize in the browser
+const webLoginTimeout = 5 * time.Minute
+
+// webLoginPage is shown in the browser after the callback is received
+const webLoginPage = `<!DOCTYPE html><html><head><meta charset="utf-8"><title>ktCloud CLI</title></head>
+<body><p>%s</p></body></html>`
+
+// webLoginToken starts the callback server, opens the authorization page in the browser
+// and waits for the web app to redirect back with the token
+func webLoginToken() (string, error) {
+	state, err := randomState()
+	if err != nil {
+		return "", err
+	}
+
+	callback, err := startCallbackServer(state)
+	if err != nil {
+		return "", err
+	}
+	defer callback.close()
+
+	authUrl := pkg.WebAuthURL(callback.url, state)
+	Print("Open this link in your browser to log in:\n%s", authUrl)
+	if err := openBrowser(authUrl); err != nil {
+		Print("Failed to open the browser automatically, please open the link manually")
+	}
+
+	return callback.wait(webLoginTimeout)
+}
+
+// callbackServer is a temporary HTTP server on the loopback interface the web app redirects to with the token.
+// The state nonce protects from forged callbacks
+type callbackServer struct {
+	// url is the redirect url of the callback
+	url    string
+	tokens chan string
+	server *http.Server
+}
+
+// startCallbackServer starts the callback server on a random port. It accepts only callbacks with the state
+func startCallbackServer(state string) (*callbackServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start callback listener: %w", err)
+	}
+
+	callback := &callbackServer{
+		url:    fmt.Sprintf("http://%s/callback", listener.Addr().String()),
+		tokens: make(chan string, 1),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, webLoginPage, "Authorization failed: bad state. Please try again from the CLI.")
+			return
+		}
+
+		token := query.Get("token")
+		if token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, webLoginPage, "Authorization failed: no token received.")
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, webLoginPage, "You are logged in. You can close this window and return to the terminal.")
+		select {
+		case callback.tokens <- token:
+		default:
+		}
+	})
+
+	callback.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = callback.server.Serve(listener)
+	}()
+
+	return callback, nil
+}
+
+// wait returns the first token received by the callback
+func (c *callbackServer) wait(timeout time.Duration) (string, error) {
+	select {
+	case token := <-c.tokens:
+		return token, nil
+	case <-time.After(timeout):
+		return "", errors.New("timed out waiting for the authorization")
+	}
+}
+
+// close stops the callback server
+func (c *callbackServer) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = c.server.Shutdown(ctx)
+}
+
+// randomState returns a random nonce for the state parameter
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// openBrowser opens the url in the default browser of the system
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	return cmd.Start()
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCallbackServer(t *testing.T) {
+	const state = "0123456789abcdef"
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		status int
+		token  string
+	}{
+		{"no state", url.Values{"token": {"secret"}}, http.StatusBadRequest, ""},
+		{"wrong state", url.Values{"token": {"secret"}, "state": {"fedcba9876543210"}}, http.StatusBadRequest, ""},
+		{"no token", url.Values{"state": {state}}, http.StatusBadRequest, ""},
+		{"token", url.Values{"token": {"secret"}, "state": {state}}, http.StatusOK, "secret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			callback, err := startCallbackServer(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer callback.close()
+
+			response, err := http.Get(callback.url + "?" + test.query.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = response.Body.Close()
+
+			if response.StatusCode != test.status {
+				t.Errorf("status = %d, want %d", response.StatusCode, test.status)
+			}
+
+			token, err := callback.wait(100 * time.Millisecond)
+			if test.token == "" {
+				if err == nil {
+					t.Errorf("token %q is accepted", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != test.token {
+				t.Errorf("token = %q, want %q", token, test.token)
+			}
+		})
+	}
+}
+
+func TestCallbackServerFirstToken(t *testing.T) {
+	const state = "0123456789abcdef"
+
+	callback, err := startCallbackServer(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer callback.close()
+
+	for _, token := range []string{"first", "second"} {
+		response, err := http.Get(callback.url + "?" + url.Values{"token": {token}, "state": {state}}.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+	}
+
+	token, err := callback.wait(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "first" {
+		t.Errorf("token = %q, want %q", token, "first")
+	}
+}
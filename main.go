@@ -9,11 +9,20 @@ import (
 
 func main() {
 	flag.Parse()
+	internal.ScanEnv()
 	internal.SetPrintMode(*internal.PrintModeFlag)
 	pkg.SetInteractiveMode(!*internal.NotInteractive)
-	internal.ScanEnv()
+	internal.ResolveConfigPath()
 	isStdIn := internal.IsStdin()
 
+	// Exit code is set at the end, it's deferred first to let the config be saved before exiting
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	// When not in debug mode, catch panics and print them in more user-friendly way like error messages
 	if !*internal.Debug {
 		defer func() {
@@ -31,23 +40,48 @@ func main() {
 		os.Exit(1)
 	}
 
+	err = config.SelectProfile(*internal.ProfileName)
+	if err != nil {
+		internal.PrintError(err.Error())
+		os.Exit(1)
+	}
+	err = internal.ApplyLayers(config)
+	if err != nil {
+		internal.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	// The store passphrase isn't asked for actions like downloading shared files that don't use the token
+	if internal.IsSecretsRequired() {
+		err = config.UnlockSecrets()
+		if err != nil {
+			internal.PrintError("Failed to unlock secrets: %s", err.Error())
+			os.Exit(1)
+		}
+	}
+
 	if !*internal.NoConfigSave {
 		// Save the config file on exit. It could change during the program execution in some cases
 		defer func() {
 			err = internal.SaveConfig(config, *internal.ConfigFilename)
 			if err != nil {
-				internal.PrintError("Failed to save config file")
+				internal.PrintError("Failed to save config file: %s", err.Error())
 			}
 		}()
 	}
 
+	internal.SetupTokenRenewing(config)
+	internal.SetupKeyPinning(config)
+	internal.SetupNameDecryption(config)
+
 	// Set the token from the command line flag to config
 	if *internal.Auth != "" {
 		config.Token = *internal.Auth
 	}
 
-	// If the token is not set, and we are not in non-interactive mode, ask for it now
-	if config.Token == "" && !*internal.NotInteractive {
+	// If the token is not set, and we are not in non-interactive mode, ask for it now.
+	// Some actions like downloading shared files or logging in don't need it
+	if config.Token == "" && !*internal.NotInteractive && !internal.IsTokenNotRequired() {
 		internal.ActionAskForToken(config)
 	}
 
@@ -58,6 +92,25 @@ func main() {
 	case *internal.Ping:
 		internal.ActionPing()
 
+	case *internal.Login || *internal.LoginWeb:
+		internal.ActionLogin(config)
+
+	case *internal.Logout || *internal.LogoutAll:
+		internal.ActionLogout(config)
+
+	case *internal.WhoAmI:
+		internal.ActionWhoAmI(config)
+
+	case *internal.Quota:
+		internal.ActionQuota(config)
+
+	// Crypt actions read stdin themselves, so they go before the upload
+	case *internal.CryptEncrypt != "":
+		internal.ActionCryptEncrypt()
+
+	case *internal.CryptDecrypt != "":
+		internal.ActionCryptDecrypt()
+
 	case *internal.Upload != "" || isStdIn:
 		internal.ActionUpload(config, isStdIn)
 
@@ -67,10 +120,107 @@ func main() {
 	case *internal.GetKeys != "":
 		internal.ActionGetKeys(config)
 
+	case *internal.Agent:
+		internal.ActionAgent()
+
+	case *internal.AgentForget:
+		internal.ActionAgentForget()
+
+	case *internal.KeysTrust != "":
+		internal.ActionKeysTrust(config)
+
+	case *internal.KeysPasswd != "":
+		internal.ActionKeysPasswd(config)
+
+	case *internal.KeysImport != "":
+		internal.ActionKeysImport(config)
+
+	case *internal.KeysGenerate != "":
+		internal.ActionKeysGenerate(config)
+
+	case *internal.KeysRotate != "":
+		internal.ActionKeysRotate(config)
+
+	case *internal.ProfileList:
+		internal.ActionProfileList(config)
+
+	case *internal.ProfileAdd != "":
+		internal.ActionProfileAdd(config)
+
+	case *internal.ProfileUse != "":
+		internal.ActionProfileUse(config)
+
+	case *internal.ProfileRemove != "":
+		internal.ActionProfileRemove(config)
+
+	case *internal.ConfigShow:
+		internal.ActionConfigShow(config)
+
+	case *internal.ConfigList:
+		internal.ActionConfigList(config)
+
+	case *internal.ConfigGet != "":
+		internal.ActionConfigGet(config)
+
+	case *internal.ConfigSet != "":
+		internal.ActionConfigSet(config)
+
+	case *internal.ConfigUnset != "":
+		internal.ActionConfigUnset(config)
+
+	case *internal.ConfigEdit:
+		internal.ActionConfigEdit(config)
+
+	case *internal.SecretsSeal:
+		internal.ActionSecretsSeal(config)
+
 	case *internal.FilesList != "":
 		internal.ActionFilesList(config)
 
+	case *internal.Disks:
+		internal.ActionDisks(config)
+
+	case *internal.DiskDefault != "":
+		internal.ActionDiskDefault(config)
+
+	case *internal.Rename != "":
+		internal.ActionRename(config)
+
+	case *internal.Move != "":
+		internal.ActionMove(config)
+
+	case *internal.Copy != "":
+		internal.ActionCopy(config)
+
+	case *internal.Delete != "":
+		internal.ActionDelete(config)
+
+	case *internal.Mkdir != "":
+		internal.ActionMkdir(config)
+
+	case *internal.ShareCreate != "":
+		internal.ActionShareCreate(config)
+
+	case *internal.ShareRevoke != "":
+		internal.ActionShareRevoke(config)
+
+	case *internal.ShareList != "":
+		internal.ActionShareList(config)
+
+	case *internal.Find != "":
+		internal.ActionFind(config)
+
+	case *internal.Stat != "":
+		internal.ActionStat(config)
+
+	case *internal.Get != "":
+		internal.ActionGet()
+
 	default:
 		internal.ActionDefault(config)
 	}
+
+	if internal.IsAuthFailed() {
+		exitCode = internal.ExitCodeAuthFailed
+	}
 }
@@ -0,0 +1,226 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The key agent keeps unlocked disk keys in memory of a separate process and gives them out through a Unix socket,
+// so the password is entered once per session instead of every run. Keys are added automatically when a disk key
+// is decrypted with the password, and they are used by TryGetReady when no password is provided.
+// The password itself is never given to the agent, it keeps only the unlocked private key
+
+// Operations of the key agent protocol. Each connection carries one JSON request and one JSON response
+const (
+	AgentOpPing   = "ping"
+	AgentOpAdd    = "add"
+	AgentOpGet    = "get"
+	AgentOpForget = "forget"
+)
+
+// AgentRequest is the request to the key agent
+type AgentRequest struct {
+	Op string `json:"op"`
+	// Endpoint and Disk identify the key, the same disk ID may exist on different servers
+	Endpoint string `json:"endpoint,omitempty"`
+	Disk     string `json:"disk,omitempty"`
+	// EncryptedKey is the crypto key as stored on the server. It lets clients notice that the key has been changed
+	EncryptedKey string `json:"encrypted_key,omitempty"`
+	// Key is the unlocked private key in binary form
+	Key []byte `json:"key,omitempty"`
+}
+
+// AgentResponse is the response of the key agent. Error is empty on success
+type AgentResponse struct {
+	Error        string `json:"error,omitempty"`
+	EncryptedKey string `json:"encrypted_key,omitempty"`
+	Key          []byte `json:"key,omitempty"`
+}
+
+// ErrNoAgent is returned when the key agent is disabled or not running
+var ErrNoAgent = errors.New("key agent is not running")
+
+// agentTimeout limits the whole exchange with the agent, it answers from memory
+const agentTimeout = 3 * time.Second
+
+var (
+	// agentSocket is the socket path of the key agent, empty path disables it. See SetAgentSocket
+	agentSocket = DefaultAgentSocket()
+	agentMutex  sync.Mutex
+)
+
+// DefaultAgentSocket returns the default socket path of the key agent: ktcloud/agent.sock in XDG_RUNTIME_DIR
+// or in a per-user directory in the temporary directory
+func DefaultAgentSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "ktcloud", "agent.sock")
+	}
+
+	dirName := "ktcloud-agent"
+	if uid := os.Getuid(); uid >= 0 {
+		dirName = fmt.Sprintf("ktcloud-%d", uid)
+	}
+
+	return filepath.Join(os.TempDir(), dirName, "agent.sock")
+}
+
+// SetAgentSocket sets the socket path of the key agent. Empty path disables the agent.
+// DefaultAgentSocket is used by default
+func SetAgentSocket(path string) {
+	agentMutex.Lock()
+	defer agentMutex.Unlock()
+
+	agentSocket = path
+}
+
+// AgentSocket returns the socket path of the key agent, it's empty if the agent is disabled
+func AgentSocket() string {
+	agentMutex.Lock()
+	defer agentMutex.Unlock()
+
+	return agentSocket
+}
+
+// CheckAgentDir checks that the directory of the agent socket belongs to the current user and is not accessible
+// by others. Otherwise, another user could put their own socket there and receive keys
+func CheckAgentDir(socket string) error {
+	return checkAgentDir(filepath.Dir(socket))
+}
+
+// AgentCall sends the request to the key agent and returns its response.
+// ErrNoAgent is returned if the agent is disabled or not running
+func AgentCall(request *AgentRequest) (*AgentResponse, error) {
+	socket := AgentSocket()
+	if socket == "" {
+		return nil, ErrNoAgent
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return nil, ErrNoAgent
+	}
+	if err := CheckAgentDir(socket); err != nil {
+		return nil, fmt.Errorf("key agent socket is not safe: %w", err)
+	}
+
+	conn, err := net.DialTimeout("unix", socket, agentTimeout)
+	if err != nil {
+		// The socket file is left by an agent which was killed
+		return nil, ErrNoAgent
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	if err = json.NewEncoder(conn).Encode(request); err != nil {
+		return nil, fmt.Errorf("failed to send request to key agent: %w", err)
+	}
+
+	response := &AgentResponse{}
+	if err = json.NewDecoder(conn).Decode(response); err != nil {
+		return nil, fmt.Errorf("failed to read response of key agent: %w", err)
+	}
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+
+	return response, nil
+}
+
+// IsAgentRunning checks if the key agent answers on its socket
+func IsAgentRunning() bool {
+	_, err := AgentCall(&AgentRequest{Op: AgentOpPing})
+	return err == nil
+}
+
+// AgentForgetKeys removes all keys from the key agent, e.g. on logout
+func AgentForgetKeys() error {
+	_, err := AgentCall(&AgentRequest{Op: AgentOpForget})
+	return err
+}
+
+// addAgentKey unlocks the decrypted key of the disk and gives it to the key agent if it's running.
+// Failures are not fatal, the password is just asked again next time
+func addAgentKey(diskId string, cryptoInfo *CryptoInfo) {
+	if socket := AgentSocket(); socket == "" {
+		return
+	} else if _, err := os.Stat(socket); err != nil {
+		return
+	}
+
+	err := func() error {
+		keyRing, err := GetPrivateKeyRing(cryptoInfo.RawCryptoKey, []byte(cryptoInfo.Password))
+		if err != nil {
+			return err
+		}
+		defer keyRing.ClearPrivateParams()
+
+		key, err := keyRing.GetKeys()[0].Serialize()
+		if err != nil {
+			return err
+		}
+		defer wipeBytes(key)
+
+		_, err = AgentCall(&AgentRequest{
+			Op:           AgentOpAdd,
+			Endpoint:     ktUrl,
+			Disk:         diskId,
+			EncryptedKey: cryptoInfo.EncryptedCryptoKey,
+			Key:          key,
+		})
+		return err
+	}()
+	if err != nil && !errors.Is(err, ErrNoAgent) {
+		currentLogger("Failed to add the key to key agent: %s", err.Error())
+	}
+}
+
+// wipeBytes overwrites the secret with zeros
+func wipeBytes(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+}
+
+// agentCryptoInfo gets the decrypted key of the disk from the key agent. The disk is still requested from the server
+// to check its public key and to make sure the agent doesn't keep an outdated key, e.g. after a password change
+func agentCryptoInfo(token string, disk string) (*CryptoInfo, error) {
+	if socket := AgentSocket(); socket == "" {
+		return nil, ErrNoAgent
+	} else if _, err := os.Stat(socket); err != nil {
+		return nil, ErrNoAgent
+	}
+
+	diskInfo, cryptoInfo, err := getDiskCryptoInfo(token, disk)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := AgentCall(&AgentRequest{Op: AgentOpGet, Endpoint: ktUrl, Disk: diskInfo.ID})
+	if err != nil {
+		return nil, err
+	}
+	if response.EncryptedKey != cryptoInfo.EncryptedCryptoKey {
+		return nil, errors.New("key agent has an outdated key of the disk")
+	}
+
+	defer wipeBytes(response.Key)
+
+	key, err := crypto.NewKey(response.Key)
+	if err != nil {
+		return nil, fmt.Errorf("bad key from key agent: %w", err)
+	}
+	defer key.ClearPrivateParams()
+
+	// The key is not locked, so it's used without the password
+	cryptoInfo.RawCryptoKey, err = key.Armor()
+	if err != nil {
+		return nil, err
+	}
+
+	return cryptoInfo, nil
+}
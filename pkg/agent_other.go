@@ -0,0 +1,8 @@
+//go:build !unix
+
+package pkg
+
+// checkAgentDir does nothing on platforms without Unix permissions, the user's directories are private there
+func checkAgentDir(string) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkAgentDir checks that the directory is owned by the current user and only the owner has access to it
+func checkAgentDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("directory %s belongs to another user", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("directory %s is accessible by other users", dir)
+	}
+
+	return nil
+}
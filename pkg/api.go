@@ -3,19 +3,44 @@ package pkg
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
-// ktUrl is the base url for the ktCloud API
-const ktUrl = "https://resistance.go-kt.com"
+// DefaultEndpoint is the base url of the official ktCloud API
+const DefaultEndpoint = "https://resistance.go-kt.com"
+
+var (
+	// ktUrl is the base url for the ktCloud API, see SetEndpoint
+	ktUrl string
+	// apiUrl is the url to JSON-RPC endpoint
+	apiUrl string
+	// uploadUrl is the url to the upload endpoint, it's separated from the JSON-RPC endpoint
+	uploadUrl string
+	// shareUrl is the prefix of public links to shared files. The secret of the file follows it
+	shareUrl string
+)
 
-// apiUrl is the url to JSON-RPC endpoint
-const apiUrl = ktUrl + "/json-rpc"
+func init() {
+	SetEndpoint(DefaultEndpoint)
+}
 
-// uploadUrl is the url to the upload endpoint, it's separated from the JSON-RPC endpoint
-const uploadUrl = ktUrl + "/upload"
+// SetEndpoint sets the base url of the API, e.g. for staging or self-hosted servers.
+// Empty endpoint resets it to DefaultEndpoint
+func SetEndpoint(endpoint string) {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+
+	ktUrl = endpoint
+	apiUrl = ktUrl + "/json-rpc"
+	uploadUrl = ktUrl + "/upload"
+	shareUrl = ktUrl + "/s/"
+}
 
 // @todo more structures instead of map[string]interface{}, better with auto generation
 
@@ -36,48 +61,124 @@ func CheckApiAlive() bool {
 	return response.StatusCode == 200 || string(text) == "Pong!"
 }
 
-// ApiRequest sends a JSON-RPC request to the API. Token can be rewritten in the params map
+// ApiRequest sends a JSON-RPC request to the API. Token can be rewritten in the params map.
+// If the token is rejected and a TokenRenewer is set, the request is retried once with the renewed token
 func ApiRequest(token string, method string, params map[string]interface{}) (*ApiResponse, error) {
 	if params == nil {
 		params = make(map[string]interface{})
 	}
 
-	if _, ok := params["token"]; !ok {
+	_, hasToken := params["token"]
+	if !hasToken {
+		token = ActualToken(token)
 		params["token"] = token
 	}
 
+	response, err := sendApiRequest(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasToken && token != "" && response.Error.Code == ErrorCodeUnauthorized {
+		if newToken, ok := renewToken(token); ok {
+			params["token"] = newToken
+			return sendApiRequest(method, params)
+		}
+	}
+
+	return response, nil
+}
+
+// sendApiRequest sends a JSON-RPC request with the params as-is. It is repeated according to the retry policy,
+// methods changing data are repeated only if the request wasn't sent
+func sendApiRequest(method string, params map[string]interface{}) (*ApiResponse, error) {
+	idempotent := isIdempotentMethod(method)
 	params = map[string]interface{}{
 		"method": method,
 		"params": params,
 	}
 
-	jsonData := jsonToReader(params)
-	if jsonData == nil {
-		return nil, errors.New("failed to convert json to reader")
-	}
-
 	requestUrl, err := url.Parse(apiUrl)
 	if err != nil {
 		return nil, err
 	}
 
 	client := KtCustomClient()
-	response, err := client.Do(&http.Request{
-		Method: "POST",
-		URL:    requestUrl,
-		Header: http.Header{"Content-Type": []string{"application/json-rpc"}},
-		Body:   jsonData,
+	var responseData *ApiResponse
+	err = withRetries(func() (bool, error) {
+		// The body is read by every attempt, so it's created again
+		jsonData := jsonToReader(params)
+		if jsonData == nil {
+			return false, errors.New("failed to convert json to reader")
+		}
+
+		response, err := client.Do(&http.Request{
+			Method: "POST",
+			URL:    requestUrl,
+			Header: http.Header{"Content-Type": []string{"application/json-rpc"}},
+			Body:   jsonData,
+		})
+		if err != nil {
+			return idempotent || isNotSentError(err), err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode >= http.StatusInternalServerError {
+			return idempotent, fmt.Errorf("server error: %s", response.Status)
+		}
+
+		responseData = &ApiResponse{}
+		return false, json.NewDecoder(response.Body).Decode(responseData)
 	})
 	if err != nil {
 		return nil, err
 	}
-	defer response.Body.Close()
 
-	responseData := &ApiResponse{}
-	err = json.NewDecoder(response.Body).Decode(responseData)
+	return responseData, nil
+}
+
+// apiCall sends a JSON-RPC request using ApiRequest and converts the result to the desired structure.
+// Errors returned by the API are converted to Go errors, so the caller doesn't need to check the response code
+func apiCall[Object any](token string, method string, params map[string]interface{}) (*Object, error) {
+	response, err := ApiRequest(token, method, params)
 	if err != nil {
 		return nil, err
 	}
+	if err = response.Err(); err != nil {
+		return nil, err
+	}
 
-	return responseData, nil
+	return MapToStruct[Object](response.Result)
+}
+
+// apiCallOk sends a JSON-RPC request that is expected to return {"ok": true} on success
+func apiCallOk(token string, method string, params map[string]interface{}) error {
+	result, err := apiCall[OkResult](token, method, params)
+	if err != nil {
+		return err
+	}
+	if !result.Ok {
+		return fmt.Errorf("%s failed (unknown reason)", method)
+	}
+
+	return nil
+}
+
+// ErrorCodeUnauthorized is the API error code returned for missing, expired or revoked tokens
+const ErrorCodeUnauthorized = 401
+
+// ApiError is an error returned by the API in ApiResponse
+type ApiError struct {
+	Code    uint
+	Message string
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+// IsUnauthorized checks if the error is the API error caused by a missing, expired or revoked token
+func IsUnauthorized(err error) bool {
+	var apiErr *ApiError
+	return errors.As(err, &apiErr) && apiErr.Code == ErrorCodeUnauthorized
 }
@@ -12,6 +12,20 @@ type ApiResponse struct {
 	Result map[string]interface{} `mapstructure:"result,omitempty"`
 }
 
+// Err returns the error of the response as *ApiError or nil if there is no error
+func (r *ApiResponse) Err() error {
+	if r.Error.Code == 0 {
+		return nil
+	}
+
+	return &ApiError{Code: r.Error.Code, Message: r.Error.Message}
+}
+
+// OkResult is the result of methods that only report success
+type OkResult struct {
+	Ok bool `mapstructure:"ok"`
+}
+
 type File struct {
 	Date       int    `mapstructure:"date"`
 	Disk       string `mapstructure:"disk"`
@@ -80,3 +94,22 @@ type DisksInfo struct {
 	Count int     `mapstructure:"count"`
 	List  []*Disk `mapstructure:"list"`
 }
+
+type FolderCreateResult struct {
+	Folder *Folder `mapstructure:"folder"`
+}
+
+type FileCopyResult struct {
+	FileID string `mapstructure:"file_id"`
+}
+
+type FolderGetByIdResult struct {
+	Folder *Folder `mapstructure:"folder"`
+}
+
+type LoginResult struct {
+	Token string `mapstructure:"token"`
+	// TwoFactor is set when the second factor code is required to finish the login
+	TwoFactor bool   `mapstructure:"two_factor"`
+	Ticket    string `mapstructure:"ticket"`
+}
@@ -2,20 +2,27 @@ package pkg
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
 )
 
-// GetUserID checks if the token is valid by calling auth.getMe method and returns the user id
-func GetUserID(token string) (string, error) {
+// GetUserInfo returns the info about the token owner by calling auth.getMe method
+func GetUserInfo(token string) (*UserInfo, error) {
 	request, err := ApiRequest(token, "auth.getMe", nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if request.Error.Code != 0 {
+	if err = request.Err(); err != nil {
 		currentLogger("Failed to get user: %s", request.Error.Message)
-		return "", errors.New(request.Error.Message)
+		return nil, err
 	}
 
-	user, err := MapToStruct[UserInfo](request.Result)
+	return MapToStruct[UserInfo](request.Result)
+}
+
+// GetUserID checks if the token is valid by calling auth.getMe method and returns the user id
+func GetUserID(token string) (string, error) {
+	user, err := GetUserInfo(token)
 	if err != nil {
 		return "", err
 	}
@@ -26,3 +33,103 @@ func GetUserID(token string) (string, error) {
 
 	return "", errors.New("failed to get user id from response")
 }
+
+// UsedSpace returns the space used by the user in bytes. Prepaid space is the total space of the account
+func (u *UserInfo) UsedSpace() int64 {
+	if u.PrepaidSpace <= u.AvailableSpace {
+		return 0
+	}
+
+	return u.PrepaidSpace - u.AvailableSpace
+}
+
+// CheckAvailableSpace returns an error if the user has less available space than required (in bytes).
+// It is used before uploads to fail fast instead of sending data the server will not accept
+func CheckAvailableSpace(token string, required int64) error {
+	user, err := GetUserInfo(token)
+	if err != nil {
+		return fmt.Errorf("failed to check available space: %w", err)
+	}
+
+	if required > user.AvailableSpace {
+		return &NotEnoughSpaceError{Required: required, Available: user.AvailableSpace}
+	}
+
+	return nil
+}
+
+// NotEnoughSpaceError is returned by CheckAvailableSpace when the data doesn't fit into the available space
+type NotEnoughSpaceError struct {
+	Required  int64
+	Available int64
+}
+
+func (e *NotEnoughSpaceError) Error() string {
+	return fmt.Sprintf("not enough space: %d bytes required, %d bytes available", e.Required, e.Available)
+}
+
+// Login gets a new access token by the user's email and password.
+// If the account has the second factor enabled, the result has TwoFactor set and no token,
+// the login should be finished with LoginTwoFactor then
+func Login(email string, password string) (*LoginResult, error) {
+	if email == "" || password == "" {
+		return nil, errors.New("email and password are required")
+	}
+
+	result, err := apiCall[LoginResult]("", "auth.login", map[string]interface{}{"email": email, "password": password})
+	if err != nil {
+		return nil, err
+	}
+
+	return checkLoginResult(result)
+}
+
+// LoginTwoFactor finishes the login started by Login with the second factor code
+func LoginTwoFactor(ticket string, code string) (*LoginResult, error) {
+	if ticket == "" || code == "" {
+		return nil, errors.New("ticket and code are required")
+	}
+
+	result, err := apiCall[LoginResult]("", "auth.twoFactor", map[string]interface{}{"ticket": ticket, "code": code})
+	if err != nil {
+		return nil, err
+	}
+
+	return checkLoginResult(result)
+}
+
+func checkLoginResult(result *LoginResult) (*LoginResult, error) {
+	if result.TwoFactor && result.Ticket == "" {
+		return nil, errors.New("second factor is required, but the server returned no ticket")
+	}
+	if !result.TwoFactor && result.Token == "" {
+		return nil, errors.New("response token is empty")
+	}
+
+	return result, nil
+}
+
+// WebAuthURL returns the url of the web app page where the user authorizes the CLI.
+// After the authorization, the browser is redirected to redirectUrl with "token" and "state" query parameters
+func WebAuthURL(redirectUrl string, state string) string {
+	query := url.Values{}
+	query.Set("redirect_uri", redirectUrl)
+	query.Set("state", state)
+
+	return ktUrl + "/auth/cli?" + query.Encode()
+}
+
+// RevokeToken revokes the token on the server, so it can't be used anymore. The token is passed as is, it's never
+// renewed (see SetTokenRenewer), and a rejected token is treated as already revoked
+func RevokeToken(token string) error {
+	if token == "" {
+		return errors.New("token is required")
+	}
+
+	err := apiCallOk("", "auth.logout", map[string]interface{}{"token": token})
+	if IsUnauthorized(err) {
+		return nil
+	}
+
+	return err
+}
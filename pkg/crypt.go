@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"io"
+	"time"
+)
+
+// EncryptData encrypts the content of the reader with the public key from CryptoInfo and writes the binary
+// OpenPGP message to the writer, the same way as UploadFile does. The message is signed with the private key
+// from CryptoInfo according to the policy. Keys are not requested from the server, CryptoInfo must already contain them
+func EncryptData(writer io.Writer, reader io.Reader, name string, cryptoInfo *CryptoInfo) error {
+	if !cryptoInfo.IsEncryptReady() {
+		return errors.New("public key is required")
+	}
+
+	publicRing, err := GetPublicKeyRing(cryptoInfo.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !publicRing.CanEncrypt() {
+		return errors.New("public key cannot encrypt")
+	}
+
+	var readyErr error
+	if !cryptoInfo.IsCryptoReady() {
+		readyErr = errors.New("private key is not provided")
+	}
+
+	signRing, err := unlockSigningKey(cryptoInfo, readyErr)
+	if err != nil {
+		return err
+	}
+	if signRing != nil {
+		defer signRing.ClearPrivateParams()
+	}
+
+	return encryptStream(writer, reader, name, publicRing, signRing)
+}
+
+// encryptStream encrypts the content of the reader with the public key ring, signing it if signRing is not nil,
+// and writes the binary message to the writer. The name is stored in the message metadata
+func encryptStream(writer io.Writer, reader io.Reader, name string, publicRing *crypto.KeyRing, signRing *crypto.KeyRing) error {
+	messageMeta := crypto.NewPlainMessageMetadata(true, name, time.Now().Unix())
+	plainWriter, err := publicRing.EncryptStreamWithCompression(writer, messageMeta, signRing)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(plainWriter, reader); err != nil {
+		_ = plainWriter.Close()
+		return err
+	}
+
+	return plainWriter.Close()
+}
+
+// DecryptStream decrypts the OpenPGP message from the reader with the private key from CryptoInfo and writes
+// the content to the writer. Armored messages are accepted too. The content is written while it is decrypted,
+// so the signature is verified according to the policy only after that: if an error is returned,
+// the written content must be discarded. Keys are not requested from the server, CryptoInfo must already contain them
+func DecryptStream(writer io.Writer, reader io.Reader, cryptoInfo *CryptoInfo) (numBytes int64, err error) {
+	if !cryptoInfo.IsCryptoReady() {
+		return 0, errors.New("private key is required")
+	}
+
+	reader, err = unarmorStream(reader)
+	if err != nil {
+		return 0, err
+	}
+
+	privateKeyRing, err := GetPrivateKeyRing(cryptoInfo.RawCryptoKey, []byte(cryptoInfo.Password))
+	if err != nil {
+		return 0, err
+	}
+	defer privateKeyRing.ClearPrivateParams()
+
+	verifyKeyRing, err := verificationKeyRing(cryptoInfo, privateKeyRing)
+	if err != nil {
+		return 0, err
+	}
+
+	var verifyTime int64
+	if verifyKeyRing != nil {
+		verifyTime = crypto.GetUnixTime()
+	}
+
+	plainReader, err := privateKeyRing.DecryptStream(reader, verifyKeyRing, verifyTime)
+	if err != nil {
+		return 0, err
+	}
+
+	numBytes, err = io.Copy(writer, plainReader)
+	if err != nil {
+		return numBytes, err
+	}
+
+	if verifyKeyRing != nil {
+		err = checkSignature(plainReader.VerifySignature())
+	}
+
+	return numBytes, err
+}
+
+// unarmorStream returns the reader of the binary message. Armored messages, e.g. copied from an email, are decoded
+func unarmorStream(reader io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+	// The error is ignored, a shorter prefix is returned for short messages
+	prefix, _ := buffered.Peek(64)
+	if !bytes.HasPrefix(bytes.TrimSpace(prefix), []byte("-----BEGIN PGP MESSAGE")) {
+		return buffered, nil
+	}
+
+	block, err := armor.Decode(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("bad armored message: %w", err)
+	}
+
+	return block.Body, nil
+}
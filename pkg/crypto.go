@@ -17,7 +17,8 @@ type CryptoInfo struct {
 	RawCryptoKey string
 	// PublicKey is the public key of the user. It is used for encryption and signature verification
 	PublicKey string
-	// Password is used to decrypt the EncryptedCryptoKey, also it is used as passphrase for the private key
+	// Password is used to decrypt the EncryptedCryptoKey, also it is used as passphrase for the private key.
+	// It's empty if RawCryptoKey is received from the key agent, the agent keeps the key unlocked
 	Password string
 }
 
@@ -27,6 +28,30 @@ func (c *CryptoInfo) IsCryptoReady() bool {
 	return c.RawCryptoKey != ""
 }
 
+// IsEncryptReady checks if the CryptoInfo has the public key. It is enough for encryption, the password is not needed
+func (c *CryptoInfo) IsEncryptReady() bool {
+	return c.PublicKey != ""
+}
+
+// TryGetPublicKey gets the public key of the disk from the server if it is not provided.
+// Unlike TryGetReady, it doesn't need the password, so files can be encrypted on machines that can't decrypt them
+func (c *CryptoInfo) TryGetPublicKey(token string, disk string) error {
+	if c.IsEncryptReady() {
+		return nil
+	}
+
+	_, diskCrypto, err := getDiskCryptoInfo(token, disk)
+	if err != nil {
+		return fmt.Errorf("failed to get public key: %w", err)
+	}
+	if diskCrypto.PublicKey == "" {
+		return errors.New("disk has no public key")
+	}
+
+	c.PublicKey = diskCrypto.PublicKey
+	return nil
+}
+
 // TryGetReady tries to get the CryptoInfo ready for encryption/decryption.
 // It tries to decrypt the key with the password.
 func (c *CryptoInfo) TryGetReady(token string, disk string) error {
@@ -35,8 +60,18 @@ func (c *CryptoInfo) TryGetReady(token string, disk string) error {
 	}
 
 	if c.Password == "" && c.RawCryptoKey == "" {
-		// Crypto data is provided, but password and key are empty
-		return errors.New("no password or decrypted key provided")
+		// Crypto data is provided, but password and key are empty. The key may be unlocked before and kept by the agent
+		crypt, err := agentCryptoInfo(token, disk)
+		if errors.Is(err, ErrNoAgent) {
+			return errors.New("no password or decrypted key provided")
+		} else if err != nil {
+			return fmt.Errorf("no password provided, and the key is not received from key agent: %w", err)
+		}
+
+		if c.PublicKey != "" {
+			crypt.PublicKey = c.PublicKey
+		}
+		*c = *crypt
 	} else if c.RawCryptoKey == "" {
 		// Password is provided, but the key is empty. We need to get and decrypt the key
 		crypt, err := GetCryptoInfo(token, disk, c.Password)
@@ -44,6 +79,10 @@ func (c *CryptoInfo) TryGetReady(token string, disk string) error {
 			return fmt.Errorf("failed to get crypto info: %w", err)
 		}
 
+		// The public key provided by the user has priority over the one from the server
+		if c.PublicKey != "" {
+			crypt.PublicKey = c.PublicKey
+		}
 		*c = *crypt
 	} else {
 		return errors.New("no any data provided")
@@ -52,10 +91,10 @@ func (c *CryptoInfo) TryGetReady(token string, disk string) error {
 	return nil
 }
 
-// GetCryptoInfo gets the CryptoInfo from the server.
-// It decrypts the crypto key if it is encrypted and a password is provided
+// GetCryptoInfo gets the CryptoInfo from the server. The public key is checked by the verifier, see SetKeyVerifier.
+// It decrypts the crypto key if it is encrypted and a password is provided, the decrypted key is given to the key agent
 func GetCryptoInfo(token string, disk string, password string) (*CryptoInfo, error) {
-	_, cryptoInfo, err := GetUserDisk(token, disk)
+	diskInfo, cryptoInfo, err := getDiskCryptoInfo(token, disk)
 	if err != nil {
 		return nil, err
 	}
@@ -72,37 +111,87 @@ func GetCryptoInfo(token string, disk string, password string) (*CryptoInfo, err
 		}
 
 		cryptoInfo.RawCryptoKey = message
+		addAgentKey(diskInfo.ID, cryptoInfo)
 	}
 
 	return cryptoInfo, nil
 }
 
-// GetKeyRings gets the public and private key rings from the armored keys
-func GetKeyRings(publicKey string, privateKey string, passwd []byte) (public *crypto.KeyRing, private *crypto.KeyRing, err error) {
-	privateKeyObj, err := crypto.NewKeyFromArmored(privateKey)
+// getDiskCryptoInfo gets the disk and its keys from the server. The public key is checked by the verifier, see SetKeyVerifier
+func getDiskCryptoInfo(token string, disk string) (*Disk, *CryptoInfo, error) {
+	diskInfo, cryptoInfo, err := GetUserDisk(token, disk)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	unlockedKeyObj, err := privateKeyObj.Unlock(passwd)
+	if err = VerifyDiskKey(diskInfo); err != nil {
+		return nil, nil, err
+	}
+
+	return diskInfo, cryptoInfo, nil
+}
+
+// GetKeyRings gets the public and private key rings from the armored keys
+func GetKeyRings(publicKey string, privateKey string, passwd []byte) (public *crypto.KeyRing, private *crypto.KeyRing, err error) {
+	private, err = GetPrivateKeyRing(privateKey, passwd)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	private, err = crypto.NewKeyRing(unlockedKeyObj)
+	public, err = GetPublicKeyRing(publicKey)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	return public, private, nil
+}
+
+// GetPublicKeyRing gets the key ring from the armored public key. It is used for encryption, so no password is needed
+func GetPublicKeyRing(publicKey string) (*crypto.KeyRing, error) {
 	publicKeyObj, err := crypto.NewKeyFromArmored(publicKey)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	public, err = crypto.NewKeyRing(publicKeyObj)
+	return crypto.NewKeyRing(publicKeyObj)
+}
+
+// GetPrivateKeyRing gets the key ring from the armored private key unlocked with the password.
+// Keys which are not locked, e.g. received from the key agent, are used with the empty password.
+// Call ClearPrivateParams of the key ring when it's not needed anymore
+func GetPrivateKeyRing(privateKey string, passwd []byte) (*crypto.KeyRing, error) {
+	privateKeyObj, err := crypto.NewKeyFromArmored(privateKey)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	return public, private, nil
+	unlockedKeyObj, err := unlockKey(privateKeyObj, passwd)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto.NewKeyRing(unlockedKeyObj)
+}
+
+// IsKeyUnlocked checks if the armored private key is not locked with a passphrase
+func IsKeyUnlocked(privateKey string) bool {
+	key, err := crypto.NewKeyFromArmored(privateKey)
+	if err != nil {
+		return false
+	}
+
+	locked, err := key.IsLocked()
+	return err == nil && !locked
+}
+
+// unlockKey returns the copy of the key unlocked with the passphrase. Keys which are not locked are copied as they are
+// if the passphrase is empty
+func unlockKey(key *crypto.Key, passphrase []byte) (*crypto.Key, error) {
+	if len(passphrase) == 0 {
+		if locked, err := key.IsLocked(); err == nil && !locked {
+			return key.Copy()
+		}
+	}
+
+	return key.Unlock(passphrase)
 }
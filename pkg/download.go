@@ -18,29 +18,10 @@ func DownloadFile(token string, fileId string, writer io.Writer, cryptoInfo *Cry
 		return "", 0, errors.New("file id is required")
 	}
 
-	filesList, err := ApiRequest(token, "files.getById", map[string]interface{}{"file": fileId})
+	fileInfo, err := GetFileById(token, fileId)
 	if err != nil {
 		return "", 0, err
 	}
-	if filesList.Error.Code != 0 {
-		return "", 0, errors.New(filesList.Error.Message)
-	}
-
-	resp, err := MapToStruct[FileGetByIdResponse](filesList.Result)
-	if err != nil {
-		return "", 0, err
-	}
-
-	if resp.Count == 0 {
-		return "", 0, errors.New("file not found or you have not access to it")
-	}
-
-	list := resp.List
-	if len(list) == 0 {
-		return "", 0, errors.New("file not found or you have not access to it")
-	}
-
-	fileInfo := list[0]
 
 	name := fileInfo.Name
 	encrypted := fileInfo.Encrypted
@@ -58,14 +39,21 @@ func DownloadFile(token string, fileId string, writer io.Writer, cryptoInfo *Cry
 		}
 	}
 
+	// The real name is decrypted with the same key as the content, even if no NameDecryptor is set
+	if encrypted && fileInfo.NameCrypto != "" {
+		if realName, err := cryptoInfo.DecryptName(fileInfo.NameCrypto); err == nil {
+			name = realName
+		}
+	}
+
 	currentLogger("Downloading file %s (%s)", name, mimeType)
 
 	downloadRequest, err := ApiRequest(token, "files.download", map[string]interface{}{"file": fileId})
 	if err != nil {
 		return "", 0, err
 	}
-	if downloadRequest.Error.Code != 0 {
-		return "", 0, errors.New(downloadRequest.Error.Message)
+	if err = downloadRequest.Err(); err != nil {
+		return "", 0, err
 	}
 
 	downloadResponse, err := MapToStruct[DownloadResponse](downloadRequest.Result)
@@ -78,48 +66,105 @@ func DownloadFile(token string, fileId string, writer io.Writer, cryptoInfo *Cry
 		return "", 0, errors.New("file url is empty")
 	}
 
-	fileResp, err := http.Get(fileUrl)
+	numBytes, err = downloadContent(fileUrl, encrypted, true, writer, cryptoInfo)
 	if err != nil {
 		return "", 0, err
 	}
+
+	currentLogger("Download is done (%d bytes)", numBytes)
+	return name, numBytes, nil
+}
+
+// downloadContent downloads the file content by the direct link and writes it to the writer.
+// Encrypted content is decrypted with the private key from CryptoInfo,
+// or with the password if there is no key (e.g. the file was encrypted by the sharer with a password).
+// The signature is verified with the public key from CryptoInfo according to the policy (see SetSignaturePolicy)
+// if verify is true
+func downloadContent(fileUrl string, encrypted bool, verify bool, writer io.Writer, cryptoInfo *CryptoInfo) (numBytes int64, err error) {
+	fileResp, err := http.Get(fileUrl)
+	if err != nil {
+		return 0, err
+	}
 	defer fileResp.Body.Close()
 
 	if fileResp.StatusCode != http.StatusOK {
-		return "", 0, fmt.Errorf("bad response status code: %s", fileResp.Status)
+		return 0, fmt.Errorf("bad response status code: %s", fileResp.Status)
 	}
 
-	if encrypted {
-		currentLogger("File is encrypted, downloading first")
-		// At the moment, we download the file to the buffer and then decrypt it.
-		// In the future, we will decrypt the file using the stream
-		buf := new(bytes.Buffer)
-		numBytes, err = io.Copy(buf, fileResp.Body)
+	if !encrypted {
+		currentLogger("File is not encrypted, downloading as-is")
+		return io.Copy(writer, fileResp.Body)
+	}
+
+	currentLogger("File is encrypted, downloading first")
+	// At the moment, we download the file to the buffer and then decrypt it.
+	// In the future, we will decrypt the file using the stream
+	buf := new(bytes.Buffer)
+	_, err = io.Copy(buf, fileResp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	currentLogger("File downloaded. Decrypting now")
+	decrypted, err := decryptData(buf.Bytes(), cryptoInfo, verify)
+	if err != nil {
+		return 0, err
+	}
+
+	currentLogger("File decrypted. Saving now")
+	return io.Copy(writer, decrypted.NewReader())
+}
 
-		currentLogger("File downloaded. Decrypting now")
-		message := crypto.NewPGPMessage(buf.Bytes())
+// DecryptData decrypts the binary OpenPGP message with the private key from CryptoInfo, or with the password
+// if there is no key. The signature is verified with the public key from CryptoInfo according to the policy.
+// Keys are not requested from the server, CryptoInfo must already contain them
+func DecryptData(data []byte, cryptoInfo *CryptoInfo) (*crypto.PlainMessage, error) {
+	return decryptData(data, cryptoInfo, true)
+}
+
+// decryptData is DecryptData that checks the signature only if verify is true
+func decryptData(data []byte, cryptoInfo *CryptoInfo, verify bool) (*crypto.PlainMessage, error) {
+	message := crypto.NewPGPMessage(data)
 
-		_, privateKeyRing, err := GetKeyRings(cryptoInfo.PublicKey, cryptoInfo.RawCryptoKey, []byte(cryptoInfo.Password))
+	var decrypted *crypto.PlainMessage
+	var err error
+	if cryptoInfo.RawCryptoKey != "" {
+		privateKeyRing, err := GetPrivateKeyRing(cryptoInfo.RawCryptoKey, []byte(cryptoInfo.Password))
 		if err != nil {
-			return "", 0, err
+			return nil, err
+		}
+		defer privateKeyRing.ClearPrivateParams()
+
+		var verifyKeyRing *crypto.KeyRing
+		if verify {
+			verifyKeyRing, err = verificationKeyRing(cryptoInfo, privateKeyRing)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		decrypted, err := privateKeyRing.Decrypt(message, nil, 0)
-		if err != nil {
-			return "", 0, err
+		var verifyTime int64
+		if verifyKeyRing != nil {
+			verifyTime = crypto.GetUnixTime()
 		}
-		privateKeyRing.ClearPrivateParams()
 
-		currentLogger("File decrypted. Saving now")
-		numBytes, err = io.Copy(writer, decrypted.NewReader())
+		decrypted, err = privateKeyRing.Decrypt(message, verifyKeyRing, verifyTime)
+		if err = checkSignature(err); err != nil {
+			return nil, err
+		}
 	} else {
-		currentLogger("File is not encrypted, downloading as-is")
-		numBytes, err = io.Copy(writer, fileResp.Body)
-	}
+		decrypted, err = crypto.DecryptMessageWithPassword(message, []byte(cryptoInfo.Password))
+		if err != nil {
+			return nil, err
+		}
 
-	if err != nil {
-		return "", 0, err
+		// There is no key of the sender for files encrypted with a password, so the signature can't be checked
+		if verify && signaturePolicy != SignatureOff {
+			if err = checkSignature(errNoVerifier); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	currentLogger("Download is done (%d bytes)", numBytes)
-	return name, numBytes, nil
+	return decrypted, nil
 }
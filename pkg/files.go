@@ -0,0 +1,379 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrFileNotFound is returned when the file doesn't exist or the user has no access to it
+var ErrFileNotFound = errors.New("file not found or you have not access to it")
+
+// GetFiles returns one page of files and folders stored in the folder of the disk.
+// Empty folder means the root folder of the disk
+func GetFiles(token string, disk string, folder string, offset int) (*FilesGetResponse, error) {
+	params := map[string]interface{}{"disk": disk, "offset": offset}
+	if folder != "" {
+		params["folder"] = folder
+	}
+
+	resp, err := apiCall[FilesGetResponse](token, "files.get", params)
+	if err != nil {
+		return nil, err
+	}
+
+	decryptFileNames(resp.List)
+	return resp, nil
+}
+
+// GetFileById returns the file info by its id
+func GetFileById(token string, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id is required")
+	}
+
+	resp, err := apiCall[FileGetByIdResponse](token, "files.getById", map[string]interface{}{"file": fileId})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Count == 0 || len(resp.List) == 0 {
+		return nil, ErrFileNotFound
+	}
+
+	decryptFileNames(resp.List[:1])
+	return resp.List[0], nil
+}
+
+// RenameFile sets a new name for the file. The encrypted name is removed, so the new name is stored as-is
+func RenameFile(token string, fileId string, name string) error {
+	if fileId == "" || name == "" {
+		return errors.New("file id and new name are required")
+	}
+
+	return apiCallOk(token, "files.rename", map[string]interface{}{"file": fileId, "name": name, "name_crypto": ""})
+}
+
+// MoveFile moves the file to another folder. The disk can be changed too, empty disk means the current one.
+// Empty folder means the root folder of the disk
+func MoveFile(token string, fileId string, disk string, folder string) error {
+	if fileId == "" {
+		return errors.New("file id is required")
+	}
+
+	params := map[string]interface{}{"file": fileId, "folder": folder}
+	if disk != "" {
+		params["disk"] = disk
+	}
+
+	return apiCallOk(token, "files.move", params)
+}
+
+// CopyFile copies the file to another folder and returns the id of the copy.
+// Disk and folder work the same way as in MoveFile
+func CopyFile(token string, fileId string, disk string, folder string) (string, error) {
+	if fileId == "" {
+		return "", errors.New("file id is required")
+	}
+
+	params := map[string]interface{}{"file": fileId, "folder": folder}
+	if disk != "" {
+		params["disk"] = disk
+	}
+
+	result, err := apiCall[FileCopyResult](token, "files.copy", params)
+	if err != nil {
+		return "", err
+	}
+	if result.FileID == "" {
+		return "", errors.New("response file_id is empty")
+	}
+
+	return result.FileID, nil
+}
+
+// DeleteFile deletes the file
+func DeleteFile(token string, fileId string) error {
+	if fileId == "" {
+		return errors.New("file id is required")
+	}
+
+	return apiCallOk(token, "files.delete", map[string]interface{}{"file": fileId})
+}
+
+// RenameFolder sets a new name for the folder
+func RenameFolder(token string, folderId string, name string) error {
+	if folderId == "" || name == "" {
+		return errors.New("folder id and new name are required")
+	}
+
+	return apiCallOk(token, "folders.rename", map[string]interface{}{"folder": folderId, "name": name})
+}
+
+// MoveFolder moves the folder with all its contents into another parent folder.
+// Empty disk means the current one, empty parent means the root folder of the disk
+func MoveFolder(token string, folderId string, disk string, parent string) error {
+	if folderId == "" {
+		return errors.New("folder id is required")
+	}
+
+	params := map[string]interface{}{"folder": folderId, "parent": parent}
+	if disk != "" {
+		params["disk"] = disk
+	}
+
+	return apiCallOk(token, "folders.move", params)
+}
+
+// DeleteFolder deletes the folder with all its contents
+func DeleteFolder(token string, folderId string) error {
+	if folderId == "" {
+		return errors.New("folder id is required")
+	}
+
+	return apiCallOk(token, "folders.delete", map[string]interface{}{"folder": folderId})
+}
+
+// CreateFolder creates a new folder in the parent folder of the disk. Empty parent means the root folder
+func CreateFolder(token string, disk string, parent string, name string) (*Folder, error) {
+	if name == "" {
+		return nil, errors.New("folder name is required")
+	}
+
+	result, err := apiCall[FolderCreateResult](token, "folders.create", map[string]interface{}{
+		"disk":   disk,
+		"parent": parent,
+		"name":   name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Folder == nil || result.Folder.ID == "" {
+		return nil, errors.New("response folder is empty")
+	}
+
+	return result.Folder, nil
+}
+
+// FindFolder looks for the folder with the name inside the parent folder. It returns nil if there is no such folder.
+// Pages are requested the same way as by GetAllFiles until the folder is found
+func FindFolder(token string, disk string, parent string, name string) (*Folder, error) {
+	offset := 0
+	for {
+		page, err := GetFiles(token, disk, parent, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, folder := range page.Folders {
+			if folder.Name == name {
+				return folder, nil
+			}
+		}
+
+		if len(page.List) == 0 {
+			return nil, nil
+		}
+
+		if page.Offset > offset {
+			offset = page.Offset
+		} else {
+			offset += len(page.List)
+		}
+	}
+}
+
+// MakeFolderPath creates the folder by the slash-separated path relative to the parent folder.
+// If createParents is true, it works like "mkdir -p": missing folders on the way are created
+// and the existing target folder is not an error. Otherwise, all folders except the last one must exist
+func MakeFolderPath(token string, disk string, parent string, path string, createParents bool) (*Folder, error) {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("folder path is empty")
+	}
+
+	var current *Folder
+	for i, name := range names {
+		isLast := i == len(names)-1
+
+		existing, err := FindFolder(token, disk, parent, name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case existing != nil && isLast && !createParents:
+			return nil, fmt.Errorf("folder %s already exists", name)
+		case existing != nil:
+			current = existing
+		case !isLast && !createParents:
+			return nil, fmt.Errorf("folder %s does not exist", name)
+		default:
+			current, err = CreateFolder(token, disk, parent, name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create folder %s: %w", name, err)
+			}
+			currentLogger("Folder %s created (%s)", name, current.ID)
+		}
+
+		parent = current.ID
+	}
+
+	return current, nil
+}
+
+// GetAllFiles returns all files and folders stored directly in the folder, requesting page by page
+func GetAllFiles(token string, disk string, folder string) (files []*File, folders []*Folder, err error) {
+	seenFolders := make(map[string]bool)
+	offset := 0
+
+	for {
+		page, err := GetFiles(token, disk, folder, offset)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, nextFolder := range page.Folders {
+			if !seenFolders[nextFolder.ID] {
+				seenFolders[nextFolder.ID] = true
+				folders = append(folders, nextFolder)
+			}
+		}
+
+		if len(page.List) == 0 {
+			break
+		}
+		files = append(files, page.List...)
+
+		// The server returns the offset of the next page, but we don't rely on it to avoid endless loops
+		if page.Offset > offset {
+			offset = page.Offset
+		} else {
+			offset += len(page.List)
+		}
+	}
+
+	return files, folders, nil
+}
+
+// FileEntry is a file found while walking the folder tree
+type FileEntry struct {
+	*File
+	// Path is the slash-separated path of the file's folder
+	Path string
+}
+
+// WalkFunc is called by WalkFiles for each file. Path is the slash-separated path of the file's folder like "/docs/"
+type WalkFunc func(path string, file *File) error
+
+// WalkFiles walks the folder tree starting from the folder (root folder if empty) and calls fn for each file.
+// Walking stops at the first error returned by fn
+func WalkFiles(token string, disk string, folder string, fn WalkFunc) error {
+	return walkFiles(token, disk, folder, "/", fn)
+}
+
+func walkFiles(token string, disk string, folder string, path string, fn WalkFunc) error {
+	files, folders, err := GetAllFiles(token, disk, folder)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := fn(path, file); err != nil {
+			return err
+		}
+	}
+
+	for _, nextFolder := range folders {
+		if err := walkFiles(token, disk, nextFolder.ID, path+nextFolder.Name+"/", fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetFolderById returns the folder info by its id
+func GetFolderById(token string, folderId string) (*Folder, error) {
+	if folderId == "" {
+		return nil, errors.New("folder id is required")
+	}
+
+	result, err := apiCall[FolderGetByIdResult](token, "folders.getById", map[string]interface{}{"folder": folderId})
+	if err != nil {
+		return nil, err
+	}
+	if result.Folder == nil || result.Folder.ID == "" {
+		return nil, errors.New("folder not found or you have not access to it")
+	}
+
+	return result.Folder, nil
+}
+
+// GetFolderPath returns the slash-separated path of the folder like "/docs/reports/".
+// Empty folder id means the root folder and "/" is returned
+func GetFolderPath(token string, folderId string) (string, error) {
+	path := "/"
+	seen := make(map[string]bool)
+
+	for folderId != "" {
+		if seen[folderId] {
+			return "", errors.New("folder tree has a loop")
+		}
+		seen[folderId] = true
+
+		folder, err := GetFolderById(token, folderId)
+		if err != nil {
+			return "", err
+		}
+
+		path = "/" + folder.Name + path
+		folderId = folder.Parent
+	}
+
+	return path, nil
+}
+
+// FindFileByPath looks for the file by its slash-separated path from the root folder of the disk, like "/docs/report.pdf"
+func FindFileByPath(token string, disk string, path string) (*File, error) {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("file path is empty")
+	}
+
+	parent := ""
+	for _, name := range names[:len(names)-1] {
+		folder, err := FindFolder(token, disk, parent, name)
+		if err != nil {
+			return nil, err
+		}
+		if folder == nil {
+			return nil, fmt.Errorf("folder %s does not exist", name)
+		}
+
+		parent = folder.ID
+	}
+
+	files, _, err := GetAllFiles(token, disk, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := names[len(names)-1]
+	for _, file := range files {
+		if file.Name == fileName {
+			return file, nil
+		}
+	}
+
+	return nil, fmt.Errorf("file %s does not exist", fileName)
+}
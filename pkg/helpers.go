@@ -1,44 +1,68 @@
 package pkg
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
-// GetUserDisk returns the user's default disk or the disk with the desired id.
+// GetUserDisks returns all disks available to the user
+func GetUserDisks(token string) ([]*Disk, error) {
+	disks, err := apiCall[DisksInfo](token, "disks.get", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return disks.List, nil
+}
+
+// GetUserDisk returns the user's default disk or the disk with the desired id or title.
+// The default disk is the first one returned by the server.
 // It also returns the crypto info for the disk
 func GetUserDisk(token string, disk string) (*Disk, *CryptoInfo, error) {
-	resp, err := ApiRequest(token, "disks.get", nil)
+	disks, err := GetUserDisks(token)
 	if err != nil {
 		return nil, nil, err
 	}
+	if len(disks) == 0 {
+		return nil, nil, errors.New("users default disk not found")
+	}
 
-	// At the moment results are not a structure, so we need to cast it to a map
-	disks, err := MapToStruct[DisksInfo](resp.Result)
+	diskInfo, err := FindDisk(disks, disk)
 	if err != nil {
 		return nil, nil, err
 	}
-	if len(disks.List) == 0 {
-		return nil, nil, fmt.Errorf("users default disk not found")
-	}
 
-	var diskInfo *Disk
-	for _, nextDisk := range disks.List {
-		// If the disk is set, we need to find the disk with the desired id
-		if disk != "" && nextDisk.ID == disk {
-			diskInfo = nextDisk
-			break
-		}
+	cryptoKey := diskInfo.CryptoKey
+	publicKey := diskInfo.PublicKey
+	return diskInfo, &CryptoInfo{EncryptedCryptoKey: cryptoKey, PublicKey: publicKey}, nil
+}
 
-		// If the disk is not set, we need to return the first disk as default
-		if disk == "" {
-			diskInfo = nextDisk
-			break
+// FindDisk finds the disk in the list by id or by title. Empty disk means the first disk in the list.
+// The id has priority over the title, and the title must be unique to be used
+func FindDisk(disks []*Disk, disk string) (*Disk, error) {
+	if disk == "" {
+		if len(disks) == 0 {
+			return nil, errors.New("users default disk not found")
 		}
+		return disks[0], nil
 	}
 
-	if diskInfo == nil {
-		return nil, nil, fmt.Errorf("disk not found")
+	var byTitle []*Disk
+	for _, nextDisk := range disks {
+		if nextDisk.ID == disk {
+			return nextDisk, nil
+		}
+		if nextDisk.Title == disk {
+			byTitle = append(byTitle, nextDisk)
+		}
 	}
 
-	cryptoKey := diskInfo.CryptoKey
-	publicKey := diskInfo.PublicKey
-	return diskInfo, &CryptoInfo{EncryptedCryptoKey: cryptoKey, PublicKey: publicKey}, nil
+	switch len(byTitle) {
+	case 0:
+		return nil, fmt.Errorf("disk %s not found", disk)
+	case 1:
+		return byTitle[0], nil
+	default:
+		return nil, fmt.Errorf("there are %d disks titled %s, use the disk id instead", len(byTitle), disk)
+	}
 }
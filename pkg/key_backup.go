@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"hash/crc32"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A paper backup is a printable text with the binary private key in base64 lines. Each line is numbered
+// and ends with a short checksum, so a key typed back from paper can be checked line by line
+
+// paperLineLength is the number of base64 characters in a line of the paper backup
+const paperLineLength = 64
+
+// paperLineRegexp matches a key line of the paper backup: number, base64 data and checksum
+var paperLineRegexp = regexp.MustCompile(`^(\d{3,})\s+([A-Za-z0-9+/=]+)\s+([0-9A-Fa-f]{4})$`)
+
+// PaperBackup returns a printable backup of the armored private key. The key stays locked with its passphrase,
+// which is not written there. The title is printed in the header, e.g. the disk name
+func PaperBackup(privateKey string, title string) (string, error) {
+	key, err := crypto.NewKeyFromArmored(privateKey)
+	if err != nil {
+		return "", err
+	}
+	if !key.IsPrivate() {
+		return "", errors.New("key is not private")
+	}
+
+	binary, err := key.Serialize()
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	text.WriteString("ktCloud disk key backup\n")
+	text.WriteString("=======================\n\n")
+	fmt.Fprintf(&text, "Disk:        %s\n", title)
+	fmt.Fprintf(&text, "Fingerprint: %s\n", strings.ToUpper(key.GetFingerprint()))
+	fmt.Fprintf(&text, "Created:     %s\n\n", time.Now().Format("2006-01-02"))
+	text.WriteString("The key is protected with its passphrase, which is not written here. Keep both in safe places.\n")
+	text.WriteString("To restore the key, type the numbered lines into a file and import it with -act.keys.import.\n")
+	text.WriteString("The last column of each line is a checksum to find typos.\n\n")
+
+	encoded := base64.StdEncoding.EncodeToString(binary)
+	for number := 1; len(encoded) > 0; number++ {
+		line := encoded
+		if len(line) > paperLineLength {
+			line = line[:paperLineLength]
+		}
+		encoded = encoded[len(line):]
+
+		fmt.Fprintf(&text, "%03d %s %s\n", number, line, paperChecksum(number, line))
+	}
+
+	return text.String(), nil
+}
+
+// ParseKeyBackup returns the armored private key from the paper backup made by PaperBackup.
+// Armored keys are returned as-is, so both formats can be imported the same way
+func ParseKeyBackup(text string) (string, error) {
+	if strings.Contains(text, "-----BEGIN PGP") {
+		return text, nil
+	}
+
+	var encoded strings.Builder
+	number := 0
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		match := paperLineRegexp.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match == nil {
+			continue
+		}
+
+		lineNumber, _ := strconv.Atoi(match[1])
+		if lineNumber != number+1 {
+			return "", fmt.Errorf("line %03d is missing", number+1)
+		}
+		if !strings.EqualFold(paperChecksum(lineNumber, match[2]), match[3]) {
+			return "", fmt.Errorf("line %03d has a typo, its checksum doesn't match", lineNumber)
+		}
+
+		encoded.WriteString(match[2])
+		number = lineNumber
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if number == 0 {
+		return "", errors.New("no key found, it should be an armored key or a paper backup")
+	}
+
+	binary, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return "", fmt.Errorf("bad key data: %w", err)
+	}
+
+	key, err := crypto.NewKey(binary)
+	if err != nil {
+		return "", fmt.Errorf("bad key data, some lines may be missing: %w", err)
+	}
+
+	return key.Armor()
+}
+
+// paperChecksum returns the checksum of the paper backup line. The line number is included, so swapped lines are found too
+func paperChecksum(number int, line string) string {
+	sum := crc32.ChecksumIEEE([]byte(strconv.Itoa(number) + line))
+	return fmt.Sprintf("%04X", sum&0xFFFF)
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyBackup(t *testing.T) {
+	key, err := crypto.GenerateKey("Test", "test@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored, err := key.Armor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := PaperBackup(armored, "Main (d1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key of this size takes a few lines, the tests below change them
+	lines := strings.Split(backup, "\n")
+	first, second := -1, -1
+	last := 0
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "001 "):
+			first = i
+		case strings.HasPrefix(line, "002 "):
+			second = i
+		}
+		if paperLineRegexp.MatchString(line) {
+			last = i
+		}
+	}
+	if first < 0 || second < 0 || last <= second {
+		t.Fatalf("backup has less than 3 key lines:\n%s", backup)
+	}
+
+	withLines := func(change func(lines []string) []string) string {
+		changed := append([]string(nil), lines...)
+		return strings.Join(change(changed), "\n")
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{"round trip", backup, ""},
+		{"armored key", armored, ""},
+		{"indented lines", withLines(func(lines []string) []string {
+			for i := range lines {
+				lines[i] = "    " + lines[i]
+			}
+			return lines
+		}), ""},
+		{"lower case checksum", withLines(func(lines []string) []string {
+			for i := first; i <= last; i++ {
+				lines[i] = lines[i][:len(lines[i])-4] + strings.ToLower(lines[i][len(lines[i])-4:])
+			}
+			return lines
+		}), ""},
+		{"missing line", withLines(func(lines []string) []string {
+			return append(lines[:second], lines[second+1:]...)
+		}), "line 002 is missing"},
+		{"swapped lines", withLines(func(lines []string) []string {
+			lines[first], lines[second] = lines[second], lines[first]
+			return lines
+		}), "line 001 is missing"},
+		{"typo", withLines(func(lines []string) []string {
+			lines[second] = swapCase(lines[second], 10)
+			return lines
+		}), "line 002 has a typo"},
+		{"missing last line", withLines(func(lines []string) []string {
+			return append(lines[:last], lines[last+1:]...)
+		}), "bad key data"},
+		{"no key", "ktCloud disk key backup\n\nnothing to restore here\n", "no key found"},
+		{"empty", "", "no key found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ParseKeyBackup(test.text)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			restored, err := crypto.NewKeyFromArmored(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored.GetFingerprint() != key.GetFingerprint() {
+				t.Errorf("fingerprint = %s, want %s", restored.GetFingerprint(), key.GetFingerprint())
+			}
+			if !restored.IsPrivate() {
+				t.Error("restored key is not private")
+			}
+		})
+	}
+}
+
+// swapCase changes the case of the first letter in the line after the position
+func swapCase(line string, position int) string {
+	for i := position; i < len(line); i++ {
+		switch c := line[i]; {
+		case c >= 'a' && c <= 'z':
+			return line[:i] + strings.ToUpper(line[i:i+1]) + line[i+1:]
+		case c >= 'A' && c <= 'Z':
+			return line[:i] + strings.ToLower(line[i:i+1]) + line[i+1:]
+		}
+	}
+
+	return line
+}
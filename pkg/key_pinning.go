@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"sync"
+)
+
+// KeyVerifier is called before a disk public key received from the server is used.
+// It should return an error if the key is not trusted, e.g. if it differs from the pinned one. See SetKeyVerifier
+type KeyVerifier func(disk *Disk, fingerprint string) error
+
+var (
+	// keyVerifier is the singleton verifier, all keys are trusted if it's nil
+	keyVerifier KeyVerifier
+	keyMutex    sync.Mutex
+)
+
+// SetKeyVerifier sets the function checking disk public keys received from the server before they are used
+// for encryption or signature verification. Keys provided by the caller in CryptoInfo are not checked.
+// By default, there is no verifier and all keys are trusted
+func SetKeyVerifier(verifier KeyVerifier) {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	keyVerifier = verifier
+}
+
+// KeyChangedError is returned by verifiers when the disk public key differs from the pinned one.
+// It may be a legitimate key rotation or the server substituting the key
+type KeyChangedError struct {
+	DiskID      string
+	Pinned      string
+	Fingerprint string
+}
+
+func (e *KeyChangedError) Error() string {
+	return fmt.Sprintf("public key of disk %s has changed: pinned fingerprint is %s, server sent %s",
+		e.DiskID, e.Pinned, e.Fingerprint)
+}
+
+// KeyFingerprint returns the hex fingerprint of the armored key's primary key
+func KeyFingerprint(armoredKey string) (string, error) {
+	key, err := crypto.NewKeyFromArmored(armoredKey)
+	if err != nil {
+		return "", err
+	}
+
+	return key.GetFingerprint(), nil
+}
+
+// VerifyDiskKey checks the public key of the disk received from the server with the verifier set by SetKeyVerifier
+func VerifyDiskKey(disk *Disk) error {
+	keyMutex.Lock()
+	verifier := keyVerifier
+	keyMutex.Unlock()
+
+	if verifier == nil || disk.PublicKey == "" {
+		return nil
+	}
+
+	fingerprint, err := KeyFingerprint(disk.PublicKey)
+	if err != nil {
+		return fmt.Errorf("bad public key of disk %s: %w", disk.ID, err)
+	}
+
+	return verifier(disk, fingerprint)
+}
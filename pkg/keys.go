@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+)
+
+// SetDiskCryptoKey replaces the encrypted crypto key of the disk stored on the server.
+// The public key is not changed, so the crypto key must contain the same private key
+func SetDiskCryptoKey(token string, diskId string, cryptoKey string) error {
+	if diskId == "" || cryptoKey == "" {
+		return errors.New("disk id and crypto key are required")
+	}
+
+	return apiCallOk(token, "disks.setCryptoKey", map[string]interface{}{"disk": diskId, "crypto_key": cryptoKey})
+}
+
+// ChangeCryptoKeyPassword re-encrypts the crypto key of the disk with the new password and stores it on the server.
+// The private key inside is locked with the new password too. The stored key is requested again and checked
+// with the new password, and the old key is put back if the check fails
+func ChangeCryptoKeyPassword(token string, disk string, oldPassword string, newPassword string) error {
+	if oldPassword == "" || newPassword == "" {
+		return errors.New("old and new passwords are required")
+	}
+
+	diskInfo, cryptoInfo, err := getDiskCryptoInfo(token, disk)
+	if err != nil {
+		return err
+	}
+	if cryptoInfo.EncryptedCryptoKey == "" {
+		return errors.New("disk has no crypto key")
+	}
+
+	rawKey, err := helper.DecryptMessageWithPassword([]byte(oldPassword), cryptoInfo.EncryptedCryptoKey)
+	if err != nil {
+		return errors.New("wrong password")
+	}
+
+	rawKey, err = RelockPrivateKey(rawKey, []byte(oldPassword), []byte(newPassword))
+	if err != nil {
+		return fmt.Errorf("failed to lock the private key with the new password: %w", err)
+	}
+
+	encrypted, err := helper.EncryptMessageWithPassword([]byte(newPassword), rawKey)
+	if err != nil {
+		return err
+	}
+	if err = checkCryptoKey(encrypted, newPassword, cryptoInfo.PublicKey); err != nil {
+		return fmt.Errorf("re-encrypted key is broken: %w", err)
+	}
+
+	if err = SetDiskCryptoKey(token, diskInfo.ID, encrypted); err != nil {
+		return err
+	}
+
+	// GetCryptoInfo gives the new key to the key agent too, the one it kept before is outdated now
+	stored, err := GetCryptoInfo(token, diskInfo.ID, newPassword)
+	if err == nil && stored.EncryptedCryptoKey != encrypted {
+		err = errors.New("server returned another key")
+	}
+	if err == nil {
+		err = checkCryptoKey(stored.EncryptedCryptoKey, newPassword, cryptoInfo.PublicKey)
+	}
+	if err != nil {
+		if restoreErr := SetDiskCryptoKey(token, diskInfo.ID, cryptoInfo.EncryptedCryptoKey); restoreErr != nil {
+			return fmt.Errorf("stored key check failed: %w, and the old key is not restored: %s", err, restoreErr.Error())
+		}
+		return fmt.Errorf("stored key check failed, the old password is kept: %w", err)
+	}
+
+	return nil
+}
+
+// RelockPrivateKey unlocks the armored private key with the old passphrase and locks it with the new one.
+// Keys which are not locked are locked with the empty old passphrase
+func RelockPrivateKey(privateKey string, oldPassphrase []byte, newPassphrase []byte) (string, error) {
+	key, err := crypto.NewKeyFromArmored(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	unlocked, err := unlockKey(key, oldPassphrase)
+	if err != nil {
+		return "", err
+	}
+	defer unlocked.ClearPrivateParams()
+
+	locked, err := unlocked.Lock(newPassphrase)
+	if err != nil {
+		return "", err
+	}
+
+	return locked.Armor()
+}
+
+// checkCryptoKey checks that the encrypted crypto key is decrypted with the password, the private key inside
+// is unlocked with it, and it matches the public key if there is one
+func checkCryptoKey(encryptedKey string, password string, publicKey string) error {
+	rawKey, err := helper.DecryptMessageWithPassword([]byte(password), encryptedKey)
+	if err != nil {
+		return err
+	}
+
+	privateKeyRing, err := GetPrivateKeyRing(rawKey, []byte(password))
+	if err != nil {
+		return err
+	}
+	defer privateKeyRing.ClearPrivateParams()
+
+	if publicKey == "" {
+		return nil
+	}
+
+	fingerprint, err := KeyFingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	if privateKeyRing.GetKeys()[0].GetFingerprint() != fingerprint {
+		return errors.New("private key doesn't match the public key")
+	}
+
+	return nil
+}
+
+// DiskKeys is a key pair of the disk
+type DiskKeys struct {
+	// PublicKey is the armored public key
+	PublicKey string
+	// PrivateKey is the armored private key locked with the password
+	PrivateKey string
+	// CryptoKey is the private key encrypted with the password, the way it's stored on the server
+	CryptoKey string
+}
+
+// GenerateDiskKeys generates a new key pair for the disk. The private key is locked with the password
+// and encrypted with it into the crypto key. The name is put into the key's user id
+func GenerateDiskKeys(name string, password string) (*DiskKeys, error) {
+	if password == "" {
+		return nil, errors.New("password is required")
+	}
+
+	privateKey, err := helper.GenerateKey(name, "", []byte(password), "x25519", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := crypto.NewKeyFromArmored(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := key.GetArmoredPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	cryptoKey, err := helper.EncryptMessageWithPassword([]byte(password), privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiskKeys{PublicKey: publicKey, PrivateKey: privateKey, CryptoKey: cryptoKey}, nil
+}
+
+// SetDiskKeys replaces the public key and the encrypted crypto key of the disk stored on the server.
+// Files encrypted with the previous key can't be decrypted with the new one
+func SetDiskKeys(token string, diskId string, publicKey string, cryptoKey string) error {
+	if diskId == "" || publicKey == "" || cryptoKey == "" {
+		return errors.New("disk id, public key and crypto key are required")
+	}
+
+	return apiCallOk(token, "disks.setKeys", map[string]interface{}{
+		"disk":       diskId,
+		"public_key": publicKey,
+		"crypto_key": cryptoKey,
+	})
+}
+
+// StoreDiskKeys stores the keys of the disk on the server, requests them again and checks them with the password.
+// The disk is requested without the key verifier, so the new key should be pinned by the caller
+func StoreDiskKeys(token string, diskId string, keys *DiskKeys, password string) error {
+	if err := checkCryptoKey(keys.CryptoKey, password, keys.PublicKey); err != nil {
+		return fmt.Errorf("generated keys are broken: %w", err)
+	}
+
+	if err := SetDiskKeys(token, diskId, keys.PublicKey, keys.CryptoKey); err != nil {
+		return err
+	}
+
+	stored, _, err := GetUserDisk(token, diskId)
+	if err != nil {
+		return fmt.Errorf("failed to check stored keys: %w", err)
+	}
+	if stored.PublicKey != keys.PublicKey || stored.CryptoKey != keys.CryptoKey {
+		return errors.New("server returned other keys")
+	}
+
+	return nil
+}
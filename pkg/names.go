@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"strings"
+	"sync"
+)
+
+// Names of encrypted files can be encrypted too. The real name is encrypted with the disk public key
+// and stored in File.NameCrypto, and the server gets a random placeholder as the name.
+// Folders don't have an encrypted name field in the API, so their names are always stored as-is
+
+// NameDecryptor returns the real name of the file from its NameCrypto. See SetNameDecryptor
+type NameDecryptor func(file *File) (string, error)
+
+var (
+	// nameEncryption enables encryption of names of uploaded files, see SetNameEncryption
+	nameEncryption bool
+	// nameDecryptor is the singleton decryptor, names are not decrypted if it's nil
+	nameDecryptor NameDecryptor
+	namesMutex    sync.Mutex
+)
+
+// SetNameEncryption enables or disables encryption of names of uploaded files. It works only for encrypted uploads.
+// Names are not encrypted by default
+func SetNameEncryption(enabled bool) {
+	namesMutex.Lock()
+	defer namesMutex.Unlock()
+
+	nameEncryption = enabled
+}
+
+// SetNameDecryptor sets the function decrypting names of files, e.g. with the private key of the file's disk.
+// Files returned by GetFiles, GetFileById and functions based on them get real names in File.Name then.
+// By default, there is no decryptor and files with encrypted names have placeholder names
+func SetNameDecryptor(decryptor NameDecryptor) {
+	namesMutex.Lock()
+	defer namesMutex.Unlock()
+
+	nameDecryptor = decryptor
+}
+
+// EncryptFileName encrypts the name with the public key and returns the armored message to be stored in File.NameCrypto
+func EncryptFileName(publicKeyRing *crypto.KeyRing, name string) (string, error) {
+	message, err := publicKeyRing.Encrypt(crypto.NewPlainMessageFromString(name), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return message.GetArmored()
+}
+
+// DecryptFileName decrypts File.NameCrypto with the unlocked private key
+func DecryptFileName(privateKeyRing *crypto.KeyRing, nameCrypto string) (string, error) {
+	message, err := crypto.NewPGPMessageFromArmored(nameCrypto)
+	if err != nil {
+		return "", err
+	}
+
+	decrypted, err := privateKeyRing.Decrypt(message, nil, 0)
+	if err != nil {
+		return "", err
+	}
+
+	name := decrypted.GetString()
+	// The name is used as a local file name on download, so it must not point outside the target directory
+	if !IsValidFileName(name) {
+		return "", errors.New("decrypted file name is not valid")
+	}
+
+	return name, nil
+}
+
+// DecryptName decrypts File.NameCrypto with the private key of the CryptoInfo. It should be ready, see TryGetReady
+func (c *CryptoInfo) DecryptName(nameCrypto string) (string, error) {
+	privateKeyRing, err := GetPrivateKeyRing(c.RawCryptoKey, []byte(c.Password))
+	if err != nil {
+		return "", err
+	}
+	defer privateKeyRing.ClearPrivateParams()
+
+	return DecryptFileName(privateKeyRing, nameCrypto)
+}
+
+// IsValidFileName checks if the name received from the server can be used as a local file name.
+// It must not be empty, point to the current or the parent directory, or contain separators and NUL
+func IsValidFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// encryptedNamePlaceholder returns a random name sent to the server instead of the encrypted one
+func encryptedNamePlaceholder() string {
+	random := make([]byte, 8)
+	_, _ = rand.Read(random)
+	return "encrypted-" + hex.EncodeToString(random)
+}
+
+// isNameEncryptionEnabled checks if names of uploaded files should be encrypted
+func isNameEncryptionEnabled() bool {
+	namesMutex.Lock()
+	defer namesMutex.Unlock()
+
+	return nameEncryption
+}
+
+// decryptFileNames replaces placeholder names of files with the real ones using the decryptor.
+// Files which names can't be decrypted keep their placeholders, the decryptor is responsible for reporting failures
+func decryptFileNames(files []*File) {
+	namesMutex.Lock()
+	decryptor := nameDecryptor
+	namesMutex.Unlock()
+
+	if decryptor == nil {
+		return
+	}
+
+	for _, file := range files {
+		if file == nil || file.NameCrypto == "" {
+			continue
+		}
+
+		if name, err := decryptor(file); err == nil {
+			file.Name = name
+		}
+	}
+}
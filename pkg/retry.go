@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	// retryCount is how many times a failed request is repeated, see SetRetryPolicy
+	retryCount = 0
+	// retryDelay is the delay before the first repeat, it is doubled after every attempt
+	retryDelay = time.Second
+)
+
+// SetRetryPolicy sets how many times API requests are repeated after network errors and server failures (HTTP 5xx),
+// and the delay before the first repeat. The delay is doubled after every attempt. Requests are not repeated by default.
+// Only methods reading data are repeated after any failure, others only if the connection couldn't be established,
+// a repeated call could otherwise apply the same change twice
+func SetRetryPolicy(count int, delay time.Duration) {
+	if count < 0 {
+		count = 0
+	}
+
+	retryCount = count
+	retryDelay = delay
+}
+
+// withRetries calls the function until it succeeds, returns a permanent error or the retries are exhausted.
+// The function reports whether its error is temporary and the call can be repeated
+func withRetries(call func() (temporary bool, err error)) error {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		temporary, err := call()
+		if err == nil || !temporary || attempt >= retryCount {
+			return err
+		}
+
+		currentLogger("Request failed (%s), retrying in %s", err.Error(), delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isIdempotentMethod checks if the API method only reads data, so calling it twice changes nothing on the server
+func isIdempotentMethod(method string) bool {
+	_, action, _ := strings.Cut(method, ".")
+	return strings.HasPrefix(action, "get") || strings.HasPrefix(action, "download")
+}
+
+// isNotSentError checks if the request failed before anything was sent, e.g. the connection was refused
+// or the host wasn't resolved. Such requests can be repeated even if they change data
+func isNotSentError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
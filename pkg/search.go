@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FileFilter describes conditions for SearchFiles. Empty fields are not checked, so an empty filter matches all files
+type FileFilter struct {
+	// Name is a glob pattern (like "*.pdf") matched against the whole file name, case-insensitive
+	Name string
+	// NameRegexp is a regular expression matched against the file name
+	NameRegexp *regexp.Regexp
+	// Mime is a glob pattern matched against the MIME type, like "image/*"
+	Mime string
+	// MinSize is the minimal size of the file in bytes
+	MinSize int64
+	// MaxSize is the maximal size of the file in bytes if set
+	MaxSize *int64
+	// After matches files created after this time
+	After time.Time
+	// Before matches files created before this time
+	Before time.Time
+	// Encrypted matches files by encryption state if set
+	Encrypted *bool
+	// Shared matches files by public link state if set
+	Shared *bool
+}
+
+// Match checks if the file meets all conditions of the filter
+func (f *FileFilter) Match(file *File) bool {
+	if f.Name != "" {
+		matched, err := path.Match(strings.ToLower(f.Name), strings.ToLower(file.Name))
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	if f.NameRegexp != nil && !f.NameRegexp.MatchString(file.Name) {
+		return false
+	}
+
+	if f.Mime != "" {
+		matched, err := path.Match(strings.ToLower(f.Mime), strings.ToLower(file.Mime))
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	size := int64(file.Size)
+	if size < f.MinSize || (f.MaxSize != nil && size > *f.MaxSize) {
+		return false
+	}
+
+	date := time.Unix(int64(file.Date), 0)
+	if (!f.After.IsZero() && !date.After(f.After)) || (!f.Before.IsZero() && !date.Before(f.Before)) {
+		return false
+	}
+
+	if f.Encrypted != nil && file.Encrypted != *f.Encrypted {
+		return false
+	}
+
+	if f.Shared != nil && file.URLShared != *f.Shared {
+		return false
+	}
+
+	return true
+}
+
+// SearchFiles walks the folder tree of the disk starting from the folder (root folder if empty)
+// and returns all files matching the filter
+func SearchFiles(token string, disk string, folder string, filter *FileFilter) ([]*FileEntry, error) {
+	var found []*FileEntry
+	err := WalkFiles(token, disk, folder, func(path string, file *File) error {
+		if filter == nil || filter.Match(file) {
+			found = append(found, &FileEntry{File: file, Path: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
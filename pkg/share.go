@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ShareFile enables public access to the file by link and returns the updated file info with URLSecret filled
+func ShareFile(token string, fileId string) (*File, error) {
+	return setFileShared(token, fileId, true)
+}
+
+// RevokeFileShare disables public access to the file. The old link stops working
+func RevokeFileShare(token string, fileId string) (*File, error) {
+	return setFileShared(token, fileId, false)
+}
+
+func setFileShared(token string, fileId string, shared bool) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id is required")
+	}
+
+	err := apiCallOk(token, "files.setShared", map[string]interface{}{"file": fileId, "shared": shared})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := GetFileById(token, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if shared && ShareURL(file) == "" {
+		return file, errors.New("file is shared, but the server returned no public link")
+	}
+
+	return file, nil
+}
+
+// ShareURL returns the public link of the shared file or an empty string if the file is not shared
+func ShareURL(file *File) string {
+	if file == nil || !file.URLShared || file.URLSecret == "" {
+		return ""
+	}
+
+	return shareUrl + url.PathEscape(file.URLSecret)
+}
+
+// GetSharedFiles walks the whole disk and returns every file that is available by public link
+func GetSharedFiles(token string, disk string) ([]*FileEntry, error) {
+	shared := true
+	return SearchFiles(token, disk, "", &FileFilter{Shared: &shared})
+}
+
+// ParseShareURL extracts the secret from the public link of the shared file.
+// The bare secret (File.URLSecret) is accepted too and returned as-is
+func ParseShareURL(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return "", errors.New("share link is empty")
+	}
+
+	if !strings.Contains(link, "/") {
+		return link, nil
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("bad share link: %w", err)
+	}
+
+	if secret := parsed.Query().Get("secret"); secret != "" {
+		return secret, nil
+	}
+
+	// The escaped path is split, so a secret with an escaped slash stays in one part
+	parts := strings.Split(strings.Trim(parsed.EscapedPath(), "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] != "s" || parts[len(parts)-1] == "" {
+		return "", errors.New("bad share link: secret not found")
+	}
+
+	return url.PathUnescape(parts[len(parts)-1])
+}
+
+// GetSharedFile returns the info of the shared file by its secret. No token is required
+func GetSharedFile(secret string) (*File, error) {
+	if secret == "" {
+		return nil, errors.New("share secret is required")
+	}
+
+	resp, err := apiCall[FileGetByIdResponse]("", "files.getShared", map[string]interface{}{"secret": secret})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Count == 0 || len(resp.List) == 0 {
+		return nil, errors.New("file not found or it is not shared anymore")
+	}
+
+	return resp.List[0], nil
+}
+
+// DownloadSharedFile downloads the shared file by its secret without an account token.
+// If the file is encrypted, you need to provide the key and/or the password the sharer gave you in CryptoInfo.
+// The keys are not requested from the server, because the disk of the file belongs to another user.
+// The signature is checked with the public key or with the public part of the private key of CryptoInfo,
+// so they should be the keys of the sharer. Without them, the signature is not checked
+func DownloadSharedFile(secret string, writer io.Writer, cryptoInfo *CryptoInfo) (fileName string, numBytes int64, err error) {
+	fileInfo, err := GetSharedFile(secret)
+	if err != nil {
+		return "", 0, err
+	}
+
+	numBytes, err = DownloadSharedFileWithInfo(secret, fileInfo, writer, cryptoInfo)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return fileInfo.Name, numBytes, nil
+}
+
+// DownloadSharedFileWithInfo is DownloadSharedFile for the file info already received by GetSharedFile,
+// so it isn't requested again
+func DownloadSharedFileWithInfo(secret string, fileInfo *File, writer io.Writer, cryptoInfo *CryptoInfo) (numBytes int64, err error) {
+	if fileInfo.Encrypted && (cryptoInfo == nil || (cryptoInfo.RawCryptoKey == "" && cryptoInfo.Password == "")) {
+		return 0, errors.New("file is encrypted, but no key or password provided")
+	}
+
+	currentLogger("Downloading shared file %s (%s)", fileInfo.Name, fileInfo.Mime)
+
+	downloadResponse, err := apiCall[DownloadResponse]("", "files.downloadShared", map[string]interface{}{"secret": secret})
+	if err != nil {
+		return 0, fmt.Errorf("cannot get download link: %w", err)
+	}
+	if downloadResponse.URL == "" {
+		return 0, errors.New("file url is empty")
+	}
+
+	// The signature can be checked only with the key of the sharer, it's unknown if only the password is given
+	verify := cryptoInfo != nil && (cryptoInfo.PublicKey != "" || cryptoInfo.RawCryptoKey != "")
+	if fileInfo.Encrypted && !verify {
+		currentLogger("Signature of the shared file is not checked, the public key of the sharer is not provided")
+	}
+
+	numBytes, err = downloadContent(downloadResponse.URL, fileInfo.Encrypted, verify, writer, cryptoInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	currentLogger("Download is done (%d bytes)", numBytes)
+	return numBytes, nil
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"testing"
+)
+
+func TestParseShareURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		link    string
+		want    string
+		wantErr bool
+	}{
+		{"bare secret", "a1b2c3", "a1b2c3", false},
+		{"bare secret with spaces", "  a1b2c3\n", "a1b2c3", false},
+		{"link", "https://resistance.go-kt.com/s/a1b2c3", "a1b2c3", false},
+		{"link with trailing slash", "https://resistance.go-kt.com/s/a1b2c3/", "a1b2c3", false},
+		{"link with path prefix", "https://example.com/cloud/s/a1b2c3", "a1b2c3", false},
+		{"escaped secret", "https://resistance.go-kt.com/s/a1%2Bb2", "a1+b2", false},
+		{"secret in query", "https://resistance.go-kt.com/share?secret=a1b2c3", "a1b2c3", false},
+		{"empty", "", "", true},
+		{"spaces only", "   ", "", true},
+		{"no secret after prefix", "https://resistance.go-kt.com/s/", "", true},
+		{"not a share link", "https://resistance.go-kt.com/files/a1b2c3", "", true},
+		{"bad link", "https://resistance.go-kt.com/s/%zz", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secret, err := ParseShareURL(test.link)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("secret %q is returned, want error", secret)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secret != test.want {
+				t.Errorf("secret = %q, want %q", secret, test.want)
+			}
+		})
+	}
+}
+
+func TestShareURLRoundTrip(t *testing.T) {
+	file := &File{URLShared: true, URLSecret: "a1+b2/c3"}
+
+	secret, err := ParseShareURL(ShareURL(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != file.URLSecret {
+		t.Errorf("secret = %q, want %q", secret, file.URLSecret)
+	}
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// SignaturePolicy defines how uploads are signed and what happens to downloaded files without a valid signature
+type SignaturePolicy int
+
+const (
+	// SignatureWarn signs uploads when the private key is available and only warns about unsigned or badly signed files
+	SignatureWarn SignaturePolicy = iota
+	// SignatureRequire fails uploads that can't be signed and rejects unsigned or badly signed files
+	SignatureRequire
+	// SignatureOff neither signs uploads nor verifies downloads
+	SignatureOff
+)
+
+// signaturePolicy is the current policy, see SetSignaturePolicy
+var signaturePolicy = SignatureWarn
+
+// SetSignaturePolicy sets how uploads are signed and downloads are verified. SignatureWarn is used by default
+func SetSignaturePolicy(policy SignaturePolicy) {
+	signaturePolicy = policy
+}
+
+// ParseSignaturePolicy parses the policy name: "warn", "require" or "off"
+func ParseSignaturePolicy(name string) (SignaturePolicy, error) {
+	switch name {
+	case "warn", "":
+		return SignatureWarn, nil
+	case "require":
+		return SignatureRequire, nil
+	case "off":
+		return SignatureOff, nil
+	}
+
+	return SignatureWarn, fmt.Errorf("unknown signature policy %s, use warn, require or off", name)
+}
+
+// errNoVerifier is used when the signature of a file can't be checked because there is no key to check it with
+var errNoVerifier = crypto.SignatureVerificationError{
+	Status:  constants.SIGNATURE_NO_VERIFIER,
+	Message: "No key to verify the signature",
+}
+
+// signingKeyRing returns the unlocked private key to sign uploads with.
+// It returns nil without error if the file should be uploaded unsigned according to the policy
+func signingKeyRing(token string, disk string, cryptoInfo *CryptoInfo) (*crypto.KeyRing, error) {
+	if signaturePolicy == SignatureOff {
+		return nil, nil
+	}
+
+	// Without the password, the key may still be received from the key agent
+	return unlockSigningKey(cryptoInfo, cryptoInfo.TryGetReady(token, disk))
+}
+
+// unlockSigningKey unlocks the private key of CryptoInfo to sign with. If the key is not ready (readyErr is not nil)
+// or can't be unlocked, it returns nil or the error according to the policy
+func unlockSigningKey(cryptoInfo *CryptoInfo, readyErr error) (*crypto.KeyRing, error) {
+	if signaturePolicy == SignatureOff {
+		return nil, nil
+	}
+
+	err := readyErr
+	if err == nil && cryptoInfo.Password == "" && !IsKeyUnlocked(cryptoInfo.RawCryptoKey) {
+		err = errors.New("password is not provided")
+	} else if err == nil {
+		var ring *crypto.KeyRing
+		ring, err = GetPrivateKeyRing(cryptoInfo.RawCryptoKey, []byte(cryptoInfo.Password))
+		if err == nil {
+			return ring, nil
+		}
+	}
+
+	if signaturePolicy == SignatureRequire {
+		return nil, fmt.Errorf("cannot sign file: %w", err)
+	}
+
+	currentLogger("WARNING: file is not signed (%s)", err.Error())
+	return nil, nil
+}
+
+// verificationKeyRing returns the key to verify signatures of downloaded files with.
+// It is the disk public key, or the public part of the private key if there is no public key.
+// It returns nil if signatures are not verified
+func verificationKeyRing(cryptoInfo *CryptoInfo, privateKeyRing *crypto.KeyRing) (*crypto.KeyRing, error) {
+	if signaturePolicy == SignatureOff {
+		return nil, nil
+	}
+	if cryptoInfo.PublicKey == "" {
+		return privateKeyRing, nil
+	}
+
+	return GetPublicKeyRing(cryptoInfo.PublicKey)
+}
+
+// checkSignature applies the policy to the signature verification error returned by decryption.
+// Other errors are returned as is
+func checkSignature(err error) error {
+	var signatureErr crypto.SignatureVerificationError
+	if !errors.As(err, &signatureErr) {
+		return err
+	}
+
+	var reason string
+	switch signatureErr.Status {
+	case constants.SIGNATURE_NOT_SIGNED:
+		reason = "file is not signed"
+	case constants.SIGNATURE_NO_VERIFIER:
+		reason = "file is not signed by a trusted key"
+	default:
+		reason = "file signature is invalid, the content may be substituted"
+	}
+
+	switch signaturePolicy {
+	case SignatureRequire:
+		return fmt.Errorf("%s: %s", reason, signatureErr.Error())
+	case SignatureWarn:
+		currentLogger("WARNING: %s (%s)", reason, signatureErr.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import "sync"
+
+// TokenRenewer is called when the API rejects the token as expired or revoked.
+// It should return a new valid token, e.g. by asking the user. See SetTokenRenewer
+type TokenRenewer func(expiredToken string) (string, error)
+
+var (
+	// tokenRenewer is the singleton renewer, no renewing is done if it's nil
+	tokenRenewer TokenRenewer
+	// renewAttempted is set after the first renewing, the renewer is called only once
+	renewAttempted bool
+	// renewedTokens maps rejected tokens to the new ones, so the next requests use the new token transparently
+	renewedTokens = make(map[string]string)
+	renewMutex    sync.Mutex
+)
+
+// SetTokenRenewer sets the function called when the API rejects the token.
+// The renewer is called only once, then the failed request and all next requests with the old token use the new one.
+// By default, there is no renewer and the API error is returned as-is
+func SetTokenRenewer(renewer TokenRenewer) {
+	renewMutex.Lock()
+	defer renewMutex.Unlock()
+
+	tokenRenewer = renewer
+	renewAttempted = false
+}
+
+// ActualToken returns the new token if the token was renewed, otherwise the token itself
+func ActualToken(token string) string {
+	renewMutex.Lock()
+	defer renewMutex.Unlock()
+
+	if newToken, ok := renewedTokens[token]; ok {
+		return newToken
+	}
+
+	return token
+}
+
+// renewToken calls the renewer for the rejected token. It returns false if the token can't be renewed
+func renewToken(expiredToken string) (string, bool) {
+	renewMutex.Lock()
+	if tokenRenewer == nil || renewAttempted {
+		renewMutex.Unlock()
+		return "", false
+	}
+	renewAttempted = true
+	renewer := tokenRenewer
+	renewMutex.Unlock()
+
+	// The renewer is called without the lock, because it may send requests itself
+	newToken, err := renewer(expiredToken)
+	if err != nil || newToken == "" {
+		currentLogger("Failed to renew the token: %v", err)
+		return "", false
+	}
+
+	renewMutex.Lock()
+	renewedTokens[expiredToken] = newToken
+	renewMutex.Unlock()
+
+	return newToken, true
+}
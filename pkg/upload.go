@@ -10,14 +10,13 @@ import (
 	"mime/multipart"
 	"net/http"
 	"strings"
-	"time"
 )
 
 // UploadFile uploads a file to the cloud.
 // If encryption is enabled, it will encrypt the file before uploading.
 // The file will be encrypted using the public key provided in the CryptoInfo struct.
-// You need public key to encrypt the file.
-// If you don't have the public key, you can get it from the server using the GetCryptoInfo function.
+// Only the public key is needed, it is taken from the disk on the server if not provided.
+// The file is also signed with the private key if the password is provided, see SetSignaturePolicy.
 func UploadFile(token string, name string, rewriteMime string, disk string, folder string, cryptoInfo *CryptoInfo, reader io.Reader) (fileId string, err error) {
 	currentLogger("Uploading file %s", name)
 
@@ -36,14 +35,13 @@ func UploadFile(token string, name string, rewriteMime string, disk string, fold
 		cryptoVal = "1"
 		currentLogger("Encrypting")
 
-		// If the crypto info is not ready, we need to get it. Nil check is not necessary because we have already checked it
-		if !cryptoInfo.IsCryptoReady() {
-			if err := cryptoInfo.TryGetReady(token, disk); err != nil {
-				return "", fmt.Errorf("failed to encrypt file: %w", err)
-			}
+		// Only the public key is needed for encryption, it's taken from the server if not provided.
+		// Nil check is not necessary because we have already checked it
+		if err := cryptoInfo.TryGetPublicKey(token, disk); err != nil {
+			return "", fmt.Errorf("failed to encrypt file: %w", err)
 		}
 
-		publicRing, _, err = GetKeyRings(cryptoInfo.PublicKey, cryptoInfo.RawCryptoKey, []byte(cryptoInfo.Password))
+		publicRing, err = GetPublicKeyRing(cryptoInfo.PublicKey)
 		if err != nil {
 			return "", err
 		}
@@ -52,95 +50,150 @@ func UploadFile(token string, name string, rewriteMime string, disk string, fold
 		}
 	}
 
-	client := &http.Client{}
-	body := &bytes.Buffer{}
-	writerMultipart := multipart.NewWriter(body)
+	form := &uploadForm{
+		disk:     strings.TrimSpace(disk),
+		folder:   strings.TrimSpace(folder),
+		crypto:   strings.TrimSpace(cryptoVal),
+		fileName: name,
+		mime:     rewriteMime,
+	}
 
-	_ = writerMultipart.WriteField("token", token)
-	_ = writerMultipart.WriteField("disk", strings.TrimSpace(disk))
-	_ = writerMultipart.WriteField("folder", strings.TrimSpace(folder))
-	_ = writerMultipart.WriteField("crypto", strings.TrimSpace(cryptoVal))
-	part, err := writerMultipart.CreateFormFile("file", name)
-	if err != nil {
-		return "", err
+	// With encrypted names, the server gets only a placeholder both in the form and in the message metadata.
+	// The type isn't taken from the name then, it would reveal the extension
+	if encrypt && isNameEncryptionEnabled() {
+		form.nameCrypto, err = EncryptFileName(publicRing, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt file name: %w", err)
+		}
+
+		form.fileName = encryptedNamePlaceholder()
+	} else if form.mime == "" {
+		form.mime = mime2.TypeByExtension(name)
 	}
 
+	// The content is prepared once, the form is built again if the request is repeated with the renewed token
+	content := &bytes.Buffer{}
 	if encrypt {
-		messageMeta := crypto.NewPlainMessageMetadata(true, name, time.Now().Unix())
-
-		plainWriter, err := publicRing.EncryptStreamWithCompression(part, messageMeta, nil)
+		signRing, err := signingKeyRing(token, disk, cryptoInfo)
 		if err != nil {
 			return "", err
 		}
+		if signRing != nil {
+			defer signRing.ClearPrivateParams()
+		}
 
-		_, err = io.Copy(plainWriter, reader)
-		_ = plainWriter.Close()
+		err = encryptStream(content, reader, form.fileName, publicRing, signRing)
 	} else {
-		_, err = io.Copy(part, reader)
+		_, err = io.Copy(content, reader)
 	}
 
 	if err != nil {
 		return "", err
 	}
+	form.content = content.Bytes()
 
-	err = writerMultipart.Close()
+	// The token is renewed the same way as by ApiRequest if it's rejected
+	currentLogger("Uploading file to server")
+	token = ActualToken(token)
+	response, responseInfo, err := form.send(token)
+	if err == nil && token != "" && response.Error.Code == ErrorCodeUnauthorized {
+		if newToken, ok := renewToken(token); ok {
+			response, responseInfo, err = form.send(newToken)
+		}
+	}
 	if err != nil {
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", uploadUrl, body)
+	if err = response.Err(); err != nil {
+		return "", fmt.Errorf("%s: %w (code %d)", responseInfo.Status, err, response.Error.Code)
+	} else if responseInfo.StatusCode != http.StatusOK {
+		return "", errors.New(responseInfo.Status)
+	}
+
+	result, err := MapToStruct[UploadResult](response.Result)
 	if err != nil {
 		return "", err
 	}
 
-	var mime string
-	if rewriteMime != "" {
-		mime = rewriteMime
-	} else {
-		mime = mime2.TypeByExtension(name)
-		if mime == "" {
-			mime = writerMultipart.FormDataContentType()
+	if result.Ok {
+		fileId = result.FileID
+		if fileId == "" {
+			return "", errors.New("response file_id is empty")
 		}
+
+		currentLogger("File uploaded successfully. File ID: %s", fileId)
+		return fileId, nil
 	}
-	req.Header.Set("Content-Type", mime)
 
-	currentLogger("Uploading file to server")
-	responseInfo, err := client.Do(req)
-	if err != nil {
-		return "", err
+	return "", errors.New("upload failed (unknown reason)")
+}
+
+// uploadForm is the multipart form of the upload request. The token is a form field, so the form is built
+// for every request
+type uploadForm struct {
+	disk       string
+	folder     string
+	crypto     string
+	nameCrypto string
+	fileName   string
+	// mime replaces the Content-Type of the request if it's not empty
+	mime    string
+	content []byte
+}
+
+// send builds the form with the token and sends it. It returns the API response and the HTTP response,
+// the body of which is already read
+func (f *uploadForm) send(token string) (*ApiResponse, *http.Response, error) {
+	body := &bytes.Buffer{}
+	writerMultipart := multipart.NewWriter(body)
+
+	_ = writerMultipart.WriteField("token", token)
+	_ = writerMultipart.WriteField("disk", f.disk)
+	_ = writerMultipart.WriteField("folder", f.folder)
+	_ = writerMultipart.WriteField("crypto", f.crypto)
+	if f.nameCrypto != "" {
+		_ = writerMultipart.WriteField("name_crypto", f.nameCrypto)
 	}
-	defer responseInfo.Body.Close()
 
-	rawResponse, err := readerToMap(responseInfo.Body)
+	part, err := writerMultipart.CreateFormFile("file", f.fileName)
 	if err != nil {
-		return "", err
+		return nil, nil, err
+	}
+	if _, err = part.Write(f.content); err != nil {
+		return nil, nil, err
+	}
+	if err = writerMultipart.Close(); err != nil {
+		return nil, nil, err
 	}
 
-	response, err := MapToStruct[ApiResponse](rawResponse)
+	req, err := http.NewRequest("POST", uploadUrl, body)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 
-	if response.Error.Code != 0 {
-		return "", fmt.Errorf("%s: %s (code %d)", responseInfo.Status, response.Error.Message, response.Error.Code)
-	} else if responseInfo.StatusCode != http.StatusOK {
-		return "", errors.New(responseInfo.Status)
+	mime := f.mime
+	if mime == "" {
+		mime = writerMultipart.FormDataContentType()
 	}
+	req.Header.Set("Content-Type", mime)
 
-	result, err := MapToStruct[UploadResult](response.Result)
+	client := &http.Client{}
+	responseInfo, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
+	defer responseInfo.Body.Close()
 
-	if result.Ok {
-		fileId = result.FileID
-		if fileId == "" {
-			return "", errors.New("response file_id is empty")
-		}
+	rawResponse, err := readerToMap(responseInfo.Body)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		currentLogger("File uploaded successfully. File ID: %s", fileId)
-		return fileId, nil
+	response, err := MapToStruct[ApiResponse](rawResponse)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return "", errors.New("upload failed (unknown reason)")
+	return response, responseInfo, nil
 }
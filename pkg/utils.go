@@ -48,3 +48,14 @@ func MapToStruct[Object any](m map[string]interface{}) (*Object, error) {
 
 	return &result, nil
 }
+
+// StructToMap converts a structure to a map with the keys of its mapstructure tags, the same keys the API uses
+func StructToMap(object interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	err := mapstructure.Decode(object, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}